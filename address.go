@@ -0,0 +1,79 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NormalizeAddresses применяет fn к адресам всех посылок в одной транзакции и возвращает
+// количество изменённых посылок. Обновляются только адреса, которые fn действительно изменила.
+// В отличие от SetAddress, меняются адреса и отправленных посылок: это исправление данных,
+// а не смена адреса. Доставленные посылки неизменяемы и пропускаются.
+// Если fn вернула пустой адрес, изменения не сохраняются
+func (s ParcelStore) NormalizeAddresses(fn func(string) string) (int64, error) {
+	defer s.observe("NormalizeAddresses", "", time.Now())
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT number, address FROM parcel WHERE status <> :delivered ORDER BY number",
+		sql.Named("delivered", ParcelStatusDelivered))
+	if err != nil {
+		return 0, err
+	}
+
+	changes := map[int]string{}
+	for rows.Next() {
+		var number int
+		var address string
+
+		err := rows.Scan(&number, &address)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		normalized := fn(address)
+		if strings.TrimSpace(normalized) == "" {
+			rows.Close()
+			return 0, fmt.Errorf("%w: empty address after normalization of parcel %d", ErrInvalidParcel, number)
+		}
+		if normalized != address {
+			changes[number] = normalized
+		}
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for number, address := range changes {
+		_, err := tx.Exec("UPDATE parcel SET address = :address, updated_at = :updated_at WHERE number = :number",
+			sql.Named("address", address),
+			sql.Named("updated_at", now),
+			sql.Named("number", number))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(changes)), nil
+}
+
+// EditableByClient возвращает посылки клиента client, адрес которых ещё можно изменить
+// через SetAddress, то есть посылки в статусе registered
+func (s ParcelStore) EditableByClient(client int) ([]Parcel, error) {
+	return s.Query().Client(client).Status(ParcelStatusRegistered).All()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestNormalizeAddresses проверяет нормализацию адресов всех посылок
+func TestNormalizeAddresses(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	for _, address := range []string{"main street", "OTHER ROAD", "Псков"} {
+		parcel := getTestParcel()
+		parcel.Address = address
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// normalize
+	n, err := store.NormalizeAddresses(strings.ToUpper)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+
+	// check
+	parcels, err := store.GetByClient(1000)
+	require.NoError(t, err)
+	require.Equal(t, "MAIN STREET", parcels[0].Address)
+	require.Equal(t, "OTHER ROAD", parcels[1].Address)
+	require.Equal(t, "ПСКОВ", parcels[2].Address)
+
+	// пустой адрес отклоняет все изменения
+	_, err = store.NormalizeAddresses(func(address string) string {
+		if address == "ПСКОВ" {
+			return ""
+		}
+		return strings.ToLower(address)
+	})
+	require.ErrorIs(t, err, ErrInvalidParcel)
+
+	parcels, err = store.GetByClient(1000)
+	require.NoError(t, err)
+	require.Equal(t, "MAIN STREET", parcels[0].Address)
+}
+
+// TestEditableByClient проверяет выборку посылок клиента, адрес которых можно изменить
+func TestEditableByClient(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	numbers, err := store.SeedParcels(1000, 3, "Unit %d")
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(numbers[1], ParcelStatusSent))
+
+	other := getTestParcel()
+	other.Client = 2000
+	_, err = store.Add(other)
+	require.NoError(t, err)
+
+	// check
+	editable, err := store.EditableByClient(1000)
+	require.NoError(t, err)
+	require.Len(t, editable, 2)
+	require.Equal(t, numbers[0], editable[0].Number)
+	require.Equal(t, numbers[2], editable[1].Number)
+
+	for _, p := range editable {
+		require.NoError(t, store.SetAddress(p.Number, "new address"))
+	}
+}
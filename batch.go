@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AddBatchBestEffort добавляет посылки по одной, не откатывая уже добавленные при ошибке.
+// inserted содержит номера добавленных посылок, failures — ошибки по индексам
+// посылок в parcels. err возвращается, только если не удалось начать транзакцию,
+// то есть при проблемах с подключением к БД; добавленные к этому моменту посылки сохраняются
+func (s ParcelStore) AddBatchBestEffort(parcels []Parcel) (inserted []int, failures map[int]error, err error) {
+	defer s.observe("AddBatchBestEffort", "", time.Now())
+
+	failures = map[int]error{}
+
+	for i, p := range parcels {
+		if err := validateParcel(p); err != nil {
+			failures[i] = err
+			continue
+		}
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return inserted, failures, checkClosed(err)
+		}
+
+		id, err := s.insertParcel(tx, p)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			tx.Rollback()
+			failures[i] = err
+			continue
+		}
+
+		inserted = append(inserted, id)
+	}
+
+	return inserted, failures, nil
+}
+
+// SeedParcels добавляет count зарегистрированных посылок клиента client в одной транзакции
+// и возвращает их номера. Адрес каждой посылки получается из addressTemplate через fmt.Sprintf
+// с порядковым номером посылки начиная с 1, например "Unit %d, Demo Street", поэтому шаблон
+// должен содержать ровно один целочисленный глагол. Нужен для нагрузочного тестирования и демонстраций
+func (s ParcelStore) SeedParcels(client, count int, addressTemplate string) ([]int, error) {
+	defer s.observe("SeedParcels", "", time.Now())
+
+	if count <= 0 {
+		return nil, fmt.Errorf("count must be positive, got %d", count)
+	}
+	err := checkAddressTemplate(addressTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+
+	numbers := make([]int, 0, count)
+	for i := 1; i <= count; i++ {
+		p := Parcel{
+			Client:    client,
+			Status:    ParcelStatusRegistered,
+			Address:   fmt.Sprintf(addressTemplate, i),
+			CreatedAt: createdAt,
+		}
+		if err := validateParcel(p); err != nil {
+			return nil, err
+		}
+
+		id, err := s.insertParcel(tx, p)
+		if err != nil {
+			return nil, err
+		}
+
+		numbers = append(numbers, id)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return numbers, nil
+}
+
+// checkAddressTemplate проверяет, что в шаблоне адреса для SeedParcels ровно один глагол
+// и он подходит для целого числа. Иначе fmt.Sprintf вставил бы в адрес текст вроде "%!(EXTRA int=1)"
+func checkAddressTemplate(template string) error {
+	verbs := strings.Count(strings.ReplaceAll(template, "%%", ""), "%")
+	if verbs != 1 || strings.Contains(fmt.Sprintf(template, 1), "%!") {
+		return fmt.Errorf("address template must contain exactly one integer verb such as %%d, got %q", template)
+	}
+	return nil
+}
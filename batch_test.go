@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestAddBatchBestEffort проверяет, что ошибка в одной посылке не мешает добавить остальные
+func TestAddBatchBestEffort(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+
+	parcels := []Parcel{
+		getTestParcel(),
+		getTestParcel(),
+		getTestParcel(),
+	}
+	parcels[1].Client = -1
+
+	// add
+	inserted, failures, err := store.AddBatchBestEffort(parcels)
+	require.NoError(t, err)
+	require.Len(t, inserted, 2)
+
+	require.Len(t, failures, 1)
+	require.ErrorIs(t, failures[1], ErrInvalidParcel)
+
+	// check
+	for _, id := range inserted {
+		stored, err := store.Get(id)
+		require.NoError(t, err)
+		require.Equal(t, parcels[0].Client, stored.Client)
+
+		err = store.Delete(id)
+		require.NoError(t, err)
+	}
+}
+
+// TestSeedParcels проверяет массовое добавление посылок с адресами по шаблону
+func TestSeedParcels(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	// seed
+	numbers, err := store.SeedParcels(1000, 20, "Unit %d, Demo Street")
+	require.NoError(t, err)
+	require.Len(t, numbers, 20)
+
+	// check
+	parcels, err := store.GetByClient(1000)
+	require.NoError(t, err)
+	require.Len(t, parcels, 20)
+	for i, p := range parcels {
+		require.Equal(t, numbers[i], p.Number)
+		require.Equal(t, fmt.Sprintf("Unit %d, Demo Street", i+1), p.Address)
+		require.Equal(t, ParcelStatusRegistered, p.Status)
+	}
+
+	_, err = store.SeedParcels(1000, 0, "Unit %d")
+	require.Error(t, err)
+
+	// шаблон без глагола, с лишним или нецелочисленным глаголом отклоняется
+	for _, template := range []string{"Demo Street", "Unit %d, %d", "Unit %s", "100%% Demo"} {
+		_, err = store.SeedParcels(2000, 1, template)
+		require.Error(t, err, template)
+	}
+	parcels, err = store.GetByClient(2000)
+	require.NoError(t, err)
+	require.Empty(t, parcels)
+
+	numbers, err = store.SeedParcels(2000, 1, "100%% Unit %d")
+	require.NoError(t, err)
+	p, err := store.Get(numbers[0])
+	require.NoError(t, err)
+	require.Equal(t, "100% Unit 1", p.Address)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SetCarrierTracking сохраняет трек-номер, выданный перевозчиком.
+// Трек-номер можно задать только отправленной посылке (в статусе sent)
+func (s ParcelStore) SetCarrierTracking(number int, tracking string) error {
+	defer s.observe("SetCarrierTracking", "", time.Now())
+
+	if strings.TrimSpace(tracking) == "" {
+		return fmt.Errorf("%w: empty carrier tracking number", ErrInvalidParcel)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	status, err := getStatus(tx, number)
+	if err != nil {
+		return err
+	}
+	if status != ParcelStatusSent {
+		return fmt.Errorf("%w: carrier tracking requires status %s, parcel %d is %s",
+			ErrWrongStatus, ParcelStatusSent, number, status)
+	}
+
+	_, err = tx.Exec("UPDATE parcel SET carrier_tracking = :tracking, updated_at = :updated_at WHERE number = :number",
+		sql.Named("tracking", tracking),
+		sql.Named("updated_at", time.Now().UTC().Format(time.RFC3339)),
+		sql.Named("number", number))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetByCarrierTracking возвращает посылку по трек-номеру перевозчика
+func (s ParcelStore) GetByCarrierTracking(tracking string) (Parcel, error) {
+	if tracking == "" {
+		return Parcel{}, ErrParcelNotFound
+	}
+
+	row := s.reader().QueryRow("SELECT "+parcelColumns+" FROM parcel WHERE carrier_tracking = :tracking",
+		sql.Named("tracking", tracking))
+	p, err := scanParcel(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, ErrParcelNotFound
+	}
+	if err != nil {
+		return p, checkClosed(err)
+	}
+
+	return p, nil
+}
+
+// PushToCarrier передаёт зарегистрированные посылки перевозчику через push, не чаще
+// ratePerSec посылок в секунду, и переводит каждую успешно переданную посылку в статус sent.
+// Посылки, взятые в работу обработчиком (см. ClaimBatch), не передаются.
+// Посылки читаются по одной в порядке номеров непосредственно перед передачей, поэтому
+// ограничение maxRows не действует, а взятые в работу во время передачи посылки пропускаются.
+// Возвращает количество переданных посылок. Ошибка push или отмена ctx останавливает
+// передачу, оставшиеся посылки остаются в статусе registered
+func (s ParcelStore) PushToCarrier(ctx context.Context, push func(Parcel) error, ratePerSec int) (int, error) {
+	if ratePerSec <= 0 {
+		return 0, fmt.Errorf("rate must be positive, got %d", ratePerSec)
+	}
+
+	ticker := time.NewTicker(time.Second / time.Duration(ratePerSec))
+	defer ticker.Stop()
+
+	pushed := 0
+	last := 0
+	for {
+		// первая посылка передаётся сразу, следующие — по тикам
+		if pushed > 0 {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return pushed, ctx.Err()
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return pushed, err
+		}
+
+		p, err := s.nextUnclaimed(ctx, last)
+		if errors.Is(err, sql.ErrNoRows) {
+			return pushed, nil
+		}
+		if err != nil {
+			return pushed, err
+		}
+		last = p.Number
+
+		err = push(p)
+		if err != nil {
+			return pushed, fmt.Errorf("push parcel %d: %w", p.Number, err)
+		}
+		pushed++
+
+		// посылку могли изменить после чтения, тогда статус не трогаем
+		_, err = s.SetStatusIf(p.Number, ParcelStatusRegistered, ParcelStatusSent)
+		if err != nil {
+			return pushed, err
+		}
+	}
+}
+
+// nextUnclaimed возвращает зарегистрированную посылку с наименьшим номером больше after,
+// которую не взял в работу ни один обработчик. Если такой нет, возвращает sql.ErrNoRows
+func (s ParcelStore) nextUnclaimed(ctx context.Context, after int) (Parcel, error) {
+	row := s.reader().QueryRowContext(ctx, `SELECT `+parcelColumns+` FROM parcel
+		WHERE status = :registered AND claimed_by = '' AND number > :after
+		ORDER BY number LIMIT 1`,
+		sql.Named("registered", ParcelStatusRegistered),
+		sql.Named("after", after))
+	p, err := scanParcel(row)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return p, checkClosed(err)
+	}
+	return p, err
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSetCarrierTracking проверяет сохранение трек-номера перевозчика
+func TestSetCarrierTracking(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// registered
+	err = store.SetCarrierTracking(id, "CR123456789")
+	require.ErrorIs(t, err, ErrWrongStatus)
+
+	// sent
+	err = store.SetStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
+
+	err = store.SetCarrierTracking(id, "CR123456789")
+	require.NoError(t, err)
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, "CR123456789", stored.CarrierTracking)
+
+	parcels, err := store.GetByClient(stored.Client)
+	require.NoError(t, err)
+	require.Contains(t, parcels, stored)
+}
+
+// TestGetByCarrierTracking проверяет поиск посылки по трек-номеру перевозчика
+func TestGetByCarrierTracking(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	_, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	err = store.SetStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
+	err = store.SetCarrierTracking(id, "CR000000042")
+	require.NoError(t, err)
+
+	// get by tracking
+	parcel, err := store.GetByCarrierTracking("CR000000042")
+	require.NoError(t, err)
+	require.Equal(t, id, parcel.Number)
+
+	// not found
+	_, err = store.GetByCarrierTracking("CR999999999")
+	require.ErrorIs(t, err, ErrParcelNotFound)
+	_, err = store.GetByCarrierTracking("")
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestPushToCarrier проверяет передачу посылок перевозчику и остановку на ошибке
+func TestPushToCarrier(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	numbers, err := store.SeedParcels(1000, 5, "Unit %d")
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(numbers[0], ParcelStatusSent))
+
+	// push: перевозчик отклоняет четвёртую посылку
+	var received []int
+	push := func(p Parcel) error {
+		if p.Number == numbers[3] {
+			return errors.New("carrier unavailable")
+		}
+		received = append(received, p.Number)
+		return nil
+	}
+
+	start := time.Now()
+	pushed, err := store.PushToCarrier(context.Background(), push, 50)
+	require.Error(t, err)
+	require.Equal(t, 2, pushed)
+	require.Equal(t, []int{numbers[1], numbers[2]}, received)
+	// между тремя вызовами push два интервала по 20 мс
+	require.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+
+	// check
+	for i, status := range []string{ParcelStatusSent, ParcelStatusSent, ParcelStatusSent, ParcelStatusRegistered, ParcelStatusRegistered} {
+		p, err := store.Get(numbers[i])
+		require.NoError(t, err)
+		require.Equal(t, status, p.Status)
+	}
+
+	// cancel
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pushed, err = store.PushToCarrier(ctx, push, 50)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Zero(t, pushed)
+}
+
+// TestPushToCarrierSkipsClaimed проверяет, что посылки, взятые в работу обработчиком, не передаются,
+// а ограничение maxRows не мешает передать все посылки
+func TestPushToCarrierSkipsClaimed(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t)).WithMaxRows(2)
+
+	numbers, err := store.SeedParcels(1000, 5, "Unit %d")
+	require.NoError(t, err)
+
+	claimed, err := store.ClaimBatch(1, "worker")
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.Equal(t, numbers[0], claimed[0].Number)
+
+	// push
+	var received []int
+	push := func(p Parcel) error {
+		received = append(received, p.Number)
+		return nil
+	}
+
+	pushed, err := store.PushToCarrier(context.Background(), push, 1000)
+	require.NoError(t, err)
+	require.Equal(t, 4, pushed)
+	require.Equal(t, numbers[1:], received)
+
+	// check
+	p, err := store.Get(numbers[0])
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, p.Status)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// LastSeq возвращает порядковый номер последнего изменения посылок (0, если изменений не было).
+// Потребитель может запомнить его, чтобы затем запросить изменения через ChangesBetween
+func (s ParcelStore) LastSeq() (int64, error) {
+	var seq int64
+
+	err := s.reader().QueryRow("SELECT COALESCE(MAX(value), 0) FROM parcel_change_seq").Scan(&seq)
+	if err != nil {
+		return 0, checkClosed(err)
+	}
+
+	return seq, nil
+}
+
+// ChangesBetween возвращает посылки, последнее изменение которых имеет порядковый номер
+// в промежутке [lowSeq, highSeq], упорядоченные по нему. Посылка, изменённая ещё раз
+// после highSeq, в результат не попадёт: хранится только последний номер изменения
+func (s ParcelStore) ChangesBetween(lowSeq, highSeq int64) ([]Parcel, error) {
+	if lowSeq > highSeq {
+		return nil, fmt.Errorf("invalid seq range [%d, %d]", lowSeq, highSeq)
+	}
+
+	return s.queryParcels("ChangesBetween", "SELECT "+parcelColumns+" FROM parcel WHERE seq BETWEEN :low AND :high ORDER BY seq",
+		sql.Named("low", lowSeq),
+		sql.Named("high", highSeq))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestChangesBetween проверяет выборку посылок по номерам изменений
+func TestChangesBetween(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	seq, err := store.LastSeq()
+	require.NoError(t, err)
+	require.Zero(t, seq)
+
+	numbers, err := store.SeedParcels(1000, 4, "Unit %d")
+	require.NoError(t, err)
+
+	start, err := store.LastSeq()
+	require.NoError(t, err)
+	require.Equal(t, int64(4), start)
+
+	// изменения: посылки 3, 1 и 4, затем ещё раз 4
+	var seqs []int64
+	for _, i := range []int{2, 0, 3, 3} {
+		err = store.SetAddress(numbers[i], "changed")
+		require.NoError(t, err)
+
+		seq, err := store.LastSeq()
+		require.NoError(t, err)
+		seqs = append(seqs, seq)
+	}
+	require.Equal(t, []int64{start + 1, start + 2, start + 3, start + 4}, seqs)
+
+	// check
+	changed, err := store.ChangesBetween(seqs[0], seqs[1])
+	require.NoError(t, err)
+	require.Len(t, changed, 2)
+	require.Equal(t, numbers[2], changed[0].Number)
+	require.Equal(t, numbers[0], changed[1].Number)
+
+	// посылка 4 изменена повторно после seqs[2], поэтому в диапазон не попадает
+	changed, err = store.ChangesBetween(seqs[2], seqs[2])
+	require.NoError(t, err)
+	require.Empty(t, changed)
+
+	changed, err = store.ChangesBetween(1, seqs[3])
+	require.NoError(t, err)
+	require.Len(t, changed, 4)
+	require.Equal(t, numbers[1], changed[0].Number)
+	require.Equal(t, numbers[3], changed[3].Number)
+
+	_, err = store.ChangesBetween(2, 1)
+	require.Error(t, err)
+}
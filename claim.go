@@ -0,0 +1,139 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// NextForProcessing берёт в работу самую старую зарегистрированную посылку:
+// переводит её в статус sent, записывает workerID в claimed_by и возвращает её.
+// Посылки, уже взятые в работу через ClaimBatch, пропускаются.
+// Если подходящих посылок нет, возвращает false.
+// Выбор и изменение посылки выполняются одним UPDATE, поэтому два обработчика
+// не могут получить одну и ту же посылку
+func (s ParcelStore) NextForProcessing(workerID string) (Parcel, bool, error) {
+	defer s.observe("NextForProcessing", "", time.Now())
+
+	if strings.TrimSpace(workerID) == "" {
+		return Parcel{}, false, errors.New("empty worker id")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Parcel{}, false, checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	// первым выполняется запрос на запись, поэтому транзакция сразу берёт блокировку на запись
+	row := tx.QueryRow(`UPDATE parcel SET status = :sent, claimed_by = :worker, claimed_at = :updated_at, updated_at = :updated_at
+		WHERE number = (SELECT number FROM parcel WHERE status = :registered AND claimed_by = '' ORDER BY created_at, number LIMIT 1)
+		RETURNING `+parcelColumns,
+		sql.Named("sent", ParcelStatusSent),
+		sql.Named("worker", workerID),
+		sql.Named("updated_at", now),
+		sql.Named("registered", ParcelStatusRegistered))
+	p, err := scanParcel(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Parcel{}, false, nil
+	}
+	if err != nil {
+		return Parcel{}, false, err
+	}
+
+	err = countStatus(tx, ParcelStatusSent)
+	if err != nil {
+		return Parcel{}, false, err
+	}
+
+	err = s.recordStatus(tx, p.Number, ParcelStatusSent, now)
+	if err != nil {
+		return Parcel{}, false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Parcel{}, false, err
+	}
+
+	return p, true, nil
+}
+
+// ClaimBatch берёт в работу до n самых старых зарегистрированных посылок, которые ещё
+// никто не взял, записывает worker в claimed_by и возвращает их. Статус посылок не меняется.
+// Так в SQLite эмулируется SELECT ... FOR UPDATE SKIP LOCKED: выбор и отметка выполняются
+// одним UPDATE, который сразу берёт блокировку на запись, как BEGIN IMMEDIATE,
+// поэтому параллельные вызовы получают разные посылки
+func (s ParcelStore) ClaimBatch(n int, worker string) ([]Parcel, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("batch size must be positive, got %d", n)
+	}
+	if strings.TrimSpace(worker) == "" {
+		return nil, errors.New("empty worker id")
+	}
+
+	query := `UPDATE parcel SET claimed_by = :worker, claimed_at = :updated_at, updated_at = :updated_at
+		WHERE number IN (
+			SELECT number FROM parcel WHERE status = :registered AND claimed_by = ''
+			ORDER BY created_at, number LIMIT :limit
+		)
+		RETURNING ` + parcelColumns
+	defer s.observe("ClaimBatch", query, time.Now())
+
+	rows, err := s.db.Query(query,
+		sql.Named("worker", worker),
+		sql.Named("updated_at", time.Now().UTC().Format(time.RFC3339)),
+		sql.Named("registered", ParcelStatusRegistered),
+		sql.Named("limit", n))
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	claimed, err := scanParcels(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// порядок строк в RETURNING не определён
+	slices.SortFunc(claimed, func(a, b Parcel) int {
+		if c := cmp.Compare(a.CreatedAt, b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Number, b.Number)
+	})
+
+	return claimed, nil
+}
+
+// ReleaseStaleClaims снимает отметку обработчика с зарегистрированных посылок, взятых
+// в работу раньше, чем olderThan назад, и возвращает количество освобождённых посылок.
+// Так посылки упавшего обработчика снова попадают в ClaimBatch. Посылки, которые
+// обработчик уже отправил, не трогаются
+func (s ParcelStore) ReleaseStaleClaims(olderThan time.Duration) (int64, error) {
+	if olderThan < 0 {
+		return 0, fmt.Errorf("threshold must not be negative, got %s", olderThan)
+	}
+
+	now := time.Now().UTC()
+
+	query := `UPDATE parcel SET claimed_by = '', claimed_at = NULL, updated_at = :updated_at
+		WHERE status = :registered AND claimed_by <> '' AND claimed_at < :cutoff`
+	defer s.observe("ReleaseStaleClaims", query, time.Now())
+
+	res, err := s.db.Exec(query,
+		sql.Named("updated_at", now.Format(time.RFC3339)),
+		sql.Named("registered", ParcelStatusRegistered),
+		sql.Named("cutoff", now.Add(-olderThan).Format(time.RFC3339)))
+	if err != nil {
+		return 0, checkClosed(err)
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestNextForProcessing проверяет, что посылка выдаётся в работу только одному обработчику
+func TestNextForProcessing(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	const total = 20
+	for i := 0; i < total; i++ {
+		_, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+	}
+
+	// claim
+	var (
+		mu      sync.Mutex
+		claimed = map[int]string{}
+		wg      sync.WaitGroup
+		errs    = make(chan error, 4)
+	)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(workerID string) {
+			defer wg.Done()
+			for {
+				p, found, err := store.NextForProcessing(workerID)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !found {
+					return
+				}
+
+				mu.Lock()
+				prev, dup := claimed[p.Number]
+				claimed[p.Number] = workerID
+				mu.Unlock()
+				if dup {
+					errs <- fmt.Errorf("parcel %d claimed by %s and %s", p.Number, prev, workerID)
+					return
+				}
+			}
+		}(fmt.Sprintf("worker-%d", w))
+	}
+	wg.Wait()
+	close(errs)
+
+	// check
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Len(t, claimed, total)
+
+	for number, workerID := range claimed {
+		p, err := store.Get(number)
+		require.NoError(t, err)
+		require.Equal(t, ParcelStatusSent, p.Status)
+
+		var claimedBy string
+		err = db.QueryRow("SELECT claimed_by FROM parcel WHERE number = ?", number).Scan(&claimedBy)
+		require.NoError(t, err)
+		require.Equal(t, workerID, claimedBy)
+	}
+
+	_, found, err := store.NextForProcessing("worker-0")
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+// TestClaimBatch проверяет, что параллельные вызовы ClaimBatch получают разные посылки
+func TestClaimBatch(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	const total = 30
+	_, err := store.SeedParcels(1000, total, "Unit %d")
+	require.NoError(t, err)
+
+	// claim
+	var (
+		mu      sync.Mutex
+		claimed = map[int]string{}
+		wg      sync.WaitGroup
+		errs    = make(chan error, 2)
+	)
+	for _, worker := range []string{"first", "second"} {
+		wg.Add(1)
+		go func(worker string) {
+			defer wg.Done()
+			for {
+				batch, err := store.ClaimBatch(4, worker)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if len(batch) == 0 {
+					return
+				}
+
+				mu.Lock()
+				for _, p := range batch {
+					if prev, dup := claimed[p.Number]; dup {
+						errs <- fmt.Errorf("parcel %d claimed by %s and %s", p.Number, prev, worker)
+					}
+					claimed[p.Number] = worker
+				}
+				mu.Unlock()
+			}
+		}(worker)
+	}
+	wg.Wait()
+	close(errs)
+
+	// check
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Len(t, claimed, total)
+
+	// взятые посылки остаются зарегистрированными, но повторно не выдаются
+	count, err := store.Query().Status(ParcelStatusRegistered).Count()
+	require.NoError(t, err)
+	require.Equal(t, total, count)
+
+	_, found, err := store.NextForProcessing("third")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	_, err = store.ClaimBatch(0, "first")
+	require.Error(t, err)
+}
+
+// TestReleaseStaleClaims проверяет, что освобождаются только давно взятые посылки
+func TestReleaseStaleClaims(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	old, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	_, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	batch, err := store.ClaimBatch(2, "crashed")
+	require.NoError(t, err)
+	require.Len(t, batch, 2)
+
+	// посылку, которую обработчик уже отправил, освобождать нельзя
+	_, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+	sent, found, err := store.NextForProcessing("sender")
+	require.NoError(t, err)
+	require.True(t, found)
+
+	// обработчики взяли посылки два часа назад, первый из них упал
+	_, err = db.Exec("UPDATE parcel SET claimed_at = ? WHERE number IN (?, ?)",
+		time.Now().UTC().Add(-2*time.Hour).Format(time.RFC3339), old, sent.Number)
+	require.NoError(t, err)
+
+	// release
+	released, err := store.ReleaseStaleClaims(time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), released)
+
+	// check
+	batch, err = store.ClaimBatch(2, "second")
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+	require.Equal(t, old, batch[0].Number)
+
+	released, err = store.ReleaseStaleClaims(time.Hour)
+	require.NoError(t, err)
+	require.Zero(t, released)
+
+	p, err := store.Get(sent.Number)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, p.Status)
+
+	var claimedBy string
+	require.NoError(t, db.QueryRow("SELECT claimed_by FROM parcel WHERE number = ?", sent.Number).Scan(&claimedBy))
+	require.Equal(t, "sender", claimedBy)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ClientChange запись из истории смены клиента посылки
+type ClientChange struct {
+	OldClient int
+	NewClient int
+	ChangedAt string
+	Reason    string
+}
+
+// getClient возвращает клиента посылки в рамках транзакции tx
+func getClient(tx *sql.Tx, number int) (int, error) {
+	var client int
+
+	err := tx.QueryRow("SELECT client FROM parcel WHERE number = :number",
+		sql.Named("number", number)).Scan(&client)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrParcelNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return client, nil
+}
+
+// setClient назначает посылке вместо клиента old клиента client в рамках транзакции tx
+// и записывает изменение с причиной reason в историю смены клиента
+func setClient(tx *sql.Tx, number int, old, client int, reason string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := tx.Exec("UPDATE parcel SET client = :client, updated_at = :updated_at WHERE number = :number",
+		sql.Named("client", client),
+		sql.Named("updated_at", now),
+		sql.Named("number", number))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO client_history (number, old_client, new_client, changed_at, reason) VALUES (:number, :old, :new, :changed_at, :reason)",
+		sql.Named("number", number),
+		sql.Named("old", old),
+		sql.Named("new", client),
+		sql.Named("changed_at", now),
+		sql.Named("reason", reason))
+
+	return err
+}
+
+// MoveClient передаёт посылку number клиенту client. Смена клиента — чувствительное
+// изменение, поэтому причина обязательна и вместе со старым и новым клиентом
+// сохраняется в истории в той же транзакции, см. GetClientChangeHistory
+func (s ParcelStore) MoveClient(number int, client int, reason string) error {
+	defer s.observe("MoveClient", "", time.Now())
+
+	if client <= 0 {
+		return fmt.Errorf("%w: client must be positive, got %d", ErrInvalidParcel, client)
+	}
+	if strings.TrimSpace(reason) == "" {
+		return ErrReasonRequired
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	err = checkMutable(tx, number)
+	if err != nil {
+		return err
+	}
+
+	old, err := getClient(tx, number)
+	if err != nil {
+		return err
+	}
+	if old == client {
+		return nil
+	}
+
+	err = setClient(tx, number, old, client, reason)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetClientChangeHistory возвращает историю смены клиента посылки от старых записей к новым
+func (s ParcelStore) GetClientChangeHistory(number int) ([]ClientChange, error) {
+	rows, err := s.reader().Query("SELECT old_client, new_client, changed_at, reason FROM client_history WHERE number = :number ORDER BY id",
+		sql.Named("number", number))
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	var res []ClientChange
+	for rows.Next() {
+		c := ClientChange{}
+
+		err := rows.Scan(&c.OldClient, &c.NewClient, &c.ChangedAt, &c.Reason)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// FrequentlyReassigned возвращает по возрастанию номера посылок, клиента которых меняли
+// не меньше minChanges раз по истории client_history. Частая смена клиента может
+// говорить о злоупотреблениях. История удалённых посылок очищается, поэтому они не попадают в результат
+func (s ParcelStore) FrequentlyReassigned(minChanges int) ([]int, error) {
+	if minChanges <= 0 {
+		return nil, fmt.Errorf("min changes must be positive, got %d", minChanges)
+	}
+
+	rows, err := s.reader().Query(`SELECT number FROM client_history
+		GROUP BY number HAVING COUNT(*) >= :min ORDER BY number`,
+		sql.Named("min", minChanges))
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	var numbers []int
+	for rows.Next() {
+		var number int
+
+		err := rows.Scan(&number)
+		if err != nil {
+			return nil, err
+		}
+
+		numbers = append(numbers, number)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return numbers, nil
+}
+
+// SwapClients меняет местами клиентов посылок a и b в одной транзакции
+func (s ParcelStore) SwapClients(a, b int) error {
+	defer s.observe("SwapClients", "", time.Now())
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	for _, number := range []int{a, b} {
+		err = checkMutable(tx, number)
+		if err != nil {
+			return err
+		}
+	}
+
+	clientA, err := getClient(tx, a)
+	if err != nil {
+		return err
+	}
+	clientB, err := getClient(tx, b)
+	if err != nil {
+		return err
+	}
+
+	err = setClient(tx, a, clientA, clientB, fmt.Sprintf("swap with parcel %d", b))
+	if err != nil {
+		return err
+	}
+	err = setClient(tx, b, clientB, clientA, fmt.Sprintf("swap with parcel %d", a))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSwapClients проверяет обмен клиентами между двумя посылками
+func TestSwapClients(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+
+	first := getTestParcel()
+	first.Client = 1001
+	a, err := store.Add(first)
+	require.NoError(t, err)
+
+	second := getTestParcel()
+	second.Client = 1002
+	b, err := store.Add(second)
+	require.NoError(t, err)
+
+	// swap
+	err = store.SwapClients(a, b)
+	require.NoError(t, err)
+
+	// check
+	stored, err := store.Get(a)
+	require.NoError(t, err)
+	require.Equal(t, 1002, stored.Client)
+
+	stored, err = store.Get(b)
+	require.NoError(t, err)
+	require.Equal(t, 1001, stored.Client)
+
+	// если одной из посылок нет, ничего не меняется
+	err = store.SwapClients(a, -1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+
+	stored, err = store.Get(a)
+	require.NoError(t, err)
+	require.Equal(t, 1002, stored.Client)
+}
+
+// TestMoveClient проверяет смену клиента посылки и запись истории
+func TestMoveClient(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// move
+	err = store.MoveClient(id, 2000, "")
+	require.ErrorIs(t, err, ErrReasonRequired)
+
+	err = store.MoveClient(id, 2000, "merged accounts")
+	require.NoError(t, err)
+	err = store.MoveClient(id, 3000, "wrong account")
+	require.NoError(t, err)
+
+	err = store.MoveClient(-1, 2000, "missing")
+	require.ErrorIs(t, err, ErrParcelNotFound)
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, 3000, stored.Client)
+
+	history, err := store.GetClientChangeHistory(id)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, 1000, history[0].OldClient)
+	require.Equal(t, 2000, history[0].NewClient)
+	require.Equal(t, "merged accounts", history[0].Reason)
+	require.Equal(t, 2000, history[1].OldClient)
+	require.Equal(t, 3000, history[1].NewClient)
+	require.Equal(t, "wrong account", history[1].Reason)
+}
+
+// TestFrequentlyReassigned проверяет поиск посылок с частой сменой клиента
+func TestFrequentlyReassigned(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	frequent, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	once, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	_, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	for _, client := range []int{2000, 3000, 4000} {
+		require.NoError(t, store.MoveClient(frequent, client, "reassign"))
+	}
+	require.NoError(t, store.MoveClient(once, 2000, "reassign"))
+
+	// check
+	numbers, err := store.FrequentlyReassigned(2)
+	require.NoError(t, err)
+	require.Equal(t, []int{frequent}, numbers)
+
+	numbers, err = store.FrequentlyReassigned(1)
+	require.NoError(t, err)
+	require.Equal(t, []int{frequent, once}, numbers)
+
+	numbers, err = store.FrequentlyReassigned(4)
+	require.NoError(t, err)
+	require.Empty(t, numbers)
+
+	_, err = store.FrequentlyReassigned(0)
+	require.Error(t, err)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// shippedTotalCounter счётчик переходов посылок в статус sent
+const shippedTotalCounter = "shipped_total"
+
+// incrementCounter увеличивает счётчик name на единицу в транзакции tx
+func incrementCounter(tx *sql.Tx, name string) error {
+	_, err := tx.Exec(`INSERT INTO counters (name, value) VALUES (:name, 1)
+		ON CONFLICT (name) DO UPDATE SET value = value + 1`,
+		sql.Named("name", name))
+	return err
+}
+
+// countStatus обновляет счётчики, связанные с переходом посылки в статус status
+func countStatus(tx *sql.Tx, status string) error {
+	if status != ParcelStatusSent {
+		return nil
+	}
+	return incrementCounter(tx, shippedTotalCounter)
+}
+
+// ShippedTotal возвращает, сколько раз посылки переводились в статус sent.
+// Значение хранится в таблице counters, поэтому чтение не требует подсчёта по parcel
+func (s ParcelStore) ShippedTotal() (int64, error) {
+	var total int64
+	err := s.reader().QueryRow("SELECT value FROM counters WHERE name = :name",
+		sql.Named("name", shippedTotalCounter)).Scan(&total)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, checkClosed(err)
+	}
+
+	return total, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestShippedTotal проверяет, что счётчик отправленных посылок растёт при переходе в статус sent
+func TestShippedTotal(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	total, err := store.ShippedTotal()
+	require.NoError(t, err)
+	require.Zero(t, total)
+
+	first, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	second, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// send
+	require.NoError(t, store.SetStatus(first, ParcelStatusSent))
+	require.NoError(t, store.SetStatus(second, ParcelStatusSent))
+
+	// доставка и отклонённый переход счётчик не меняют
+	require.NoError(t, store.SetStatus(first, ParcelStatusDelivered))
+	require.Error(t, store.SetStatus(second, ParcelStatusSent))
+
+	// check
+	total, err = store.ShippedTotal()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), total)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvHeader заголовок CSV-файла с посылками
+var csvHeader = []string{"client", "status", "address", "created_at"}
+
+// RowError ошибка проверки одной строки CSV-файла
+type RowError struct {
+	Line   int
+	Reason string
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// ImportCSV загружает посылки из CSV-файла с заголовком client,status,address,created_at.
+// Пустой created_at заменяется текущим временем.
+// Строки, не прошедшие проверку, пропускаются и возвращаются в errs, остальные
+// добавляются в одной транзакции. err возвращается только при ошибке чтения
+// файла или БД, в этом случае ни одна посылка не добавляется
+func (s ParcelStore) ImportCSV(r io.Reader) (imported int, errs []RowError, err error) {
+	defer s.observe("ImportCSV", "", time.Now())
+
+	reader := csv.NewReader(r)
+	// количество полей проверяем сами, чтобы не прерывать загрузку
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if !slices.Equal(header, csvHeader) {
+		return 0, nil, fmt.Errorf("unexpected csv header %v, want %v", header, csvHeader)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, nil, checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, errs, err
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		p, err := parseCSVRecord(record)
+		if err == nil {
+			err = validateParcel(p)
+		}
+		if err != nil {
+			errs = append(errs, RowError{Line: line, Reason: err.Error()})
+			continue
+		}
+
+		_, err = s.insertParcel(tx, p)
+		if err != nil {
+			return 0, errs, err
+		}
+		imported++
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, errs, err
+	}
+
+	return imported, errs, nil
+}
+
+// parseCSVRecord преобразует строку CSV-файла в посылку
+func parseCSVRecord(record []string) (Parcel, error) {
+	if len(record) != len(csvHeader) {
+		return Parcel{}, fmt.Errorf("expected %d fields, got %d", len(csvHeader), len(record))
+	}
+
+	client, err := strconv.Atoi(record[0])
+	if err != nil {
+		return Parcel{}, fmt.Errorf("invalid client %q", record[0])
+	}
+
+	createdAt := record[3]
+	if createdAt == "" {
+		createdAt = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	return Parcel{
+		Client:    client,
+		Status:    record[1],
+		Address:   record[2],
+		CreatedAt: createdAt,
+	}, nil
+}
+
+// SetStatusFromCSV переводит в статус status посылки, номера которых перечислены
+// в CSV-файле из одного столбца. Первая строка может быть заголовком number.
+// Посылки, которых нет или для которых переход недопустим, пропускаются и возвращаются
+// в skipped, остальные обновляются в одной транзакции. При нечисловом номере
+// или ошибке чтения не обновляется ни одна посылка
+func (s ParcelStore) SetStatusFromCSV(r io.Reader, status string) (updated int, skipped []int, err error) {
+	defer s.observe("SetStatusFromCSV", "", time.Now())
+
+	if !validStatus(status) {
+		return 0, nil, fmt.Errorf("%w %q", ErrUnknownStatus, status)
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 1
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, nil, checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+
+		field := strings.TrimSpace(record[0])
+		if first && field == "number" {
+			continue
+		}
+
+		number, err := strconv.Atoi(field)
+		if err != nil {
+			line, _ := reader.FieldPos(0)
+			return 0, nil, RowError{Line: line, Reason: fmt.Sprintf("invalid number %q", field)}
+		}
+
+		current, err := getStatus(tx, number)
+		if errors.Is(err, ErrParcelNotFound) {
+			skipped = append(skipped, number)
+			continue
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if !CanTransition(current, status) {
+			skipped = append(skipped, number)
+			continue
+		}
+
+		err = s.changeStatus(tx, number, current, status, "")
+		if err != nil {
+			return 0, nil, err
+		}
+		updated++
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return updated, skipped, nil
+}
+
+// ExportCSV записывает в w посылки, подходящие под фильтры, в формате CSV с заголовком
+// number,client,status,address,created_at, упорядоченные по номеру.
+// Посылки пишутся по мере чтения из БД, весь результат в памяти не собирается
+func (q ParcelQuery) ExportCSV(w io.Writer) error {
+	rows, err := q.store.reader().Query("SELECT "+parcelColumns+" FROM parcel"+q.whereClause()+" ORDER BY number",
+		q.args...)
+	if err != nil {
+		return checkClosed(err)
+	}
+	defer rows.Close()
+
+	cw := csv.NewWriter(w)
+	err = cw.Write(append([]string{"number"}, csvHeader...))
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		p, err := scanParcel(rows)
+		if err != nil {
+			return err
+		}
+
+		err = cw.Write([]string{strconv.Itoa(p.Number), strconv.Itoa(p.Client), p.Status, p.Address, p.CreatedAt})
+		if err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
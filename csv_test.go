@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestImportCSV проверяет загрузку посылок из CSV-файла с корректными и ошибочными строками
+func TestImportCSV(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+	client := randRange.Intn(10_000_000) + 1
+
+	data := strings.Join([]string{
+		"client,status,address,created_at",
+		strconv.Itoa(client) + ",registered,first address,2024-01-02T03:04:05Z",
+		"0,registered,bad client,",
+		strconv.Itoa(client) + ",lost,bad status,",
+		strconv.Itoa(client) + ",sent,second address,",
+		strconv.Itoa(client) + ",registered,,",
+		strconv.Itoa(client) + ",registered",
+	}, "\n")
+
+	// import
+	imported, errs, err := store.ImportCSV(strings.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, 2, imported)
+
+	require.Len(t, errs, 4)
+	require.Equal(t, 3, errs[0].Line)
+	require.Equal(t, 4, errs[1].Line)
+	require.Equal(t, 6, errs[2].Line)
+	require.Equal(t, 7, errs[3].Line)
+
+	// check
+	stored, err := store.GetByClient(client)
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+
+	addresses := []string{stored[0].Address, stored[1].Address}
+	require.ElementsMatch(t, []string{"first address", "second address"}, addresses)
+}
+
+// TestSetStatusFromCSV проверяет перевод в статус посылок из списка номеров
+func TestSetStatusFromCSV(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	numbers, err := store.SeedParcels(1000, 3, "Unit %d")
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(numbers[2], ParcelStatusSent))
+
+	data := strings.Join([]string{
+		"number",
+		strconv.Itoa(numbers[0]),
+		strconv.Itoa(numbers[1]),
+		strconv.Itoa(numbers[2]),
+		"1000000",
+	}, "\n")
+
+	// set status
+	updated, skipped, err := store.SetStatusFromCSV(strings.NewReader(data), ParcelStatusSent)
+	require.NoError(t, err)
+	require.Equal(t, 2, updated)
+	require.Equal(t, []int{numbers[2], 1000000}, skipped)
+
+	// check
+	for _, number := range numbers[:2] {
+		p, err := store.Get(number)
+		require.NoError(t, err)
+		require.Equal(t, ParcelStatusSent, p.Status)
+	}
+
+	// при ошибке в файле ничего не меняется
+	data = strconv.Itoa(numbers[0]) + "\nabc\n"
+	_, _, err = store.SetStatusFromCSV(strings.NewReader(data), ParcelStatusDelivered)
+	require.Error(t, err)
+
+	p, err := store.Get(numbers[0])
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, p.Status)
+
+	_, _, err = store.SetStatusFromCSV(strings.NewReader(data), "lost")
+	require.ErrorIs(t, err, ErrUnknownStatus)
+}
+
+// TestQueryExportCSV проверяет выгрузку в CSV только посылок, подходящих под фильтр
+func TestQueryExportCSV(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	numbers, err := store.SeedParcels(1000, 3, "Unit %d, \"A\"")
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(numbers[0], ParcelStatusSent))
+	require.NoError(t, store.SetStatus(numbers[2], ParcelStatusSent))
+
+	// export
+	var buf strings.Builder
+	err = store.Query().Status(ParcelStatusSent).ExportCSV(&buf)
+	require.NoError(t, err)
+
+	// check
+	records, err := csv.NewReader(strings.NewReader(buf.String())).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.Equal(t, []string{"number", "client", "status", "address", "created_at"}, records[0])
+
+	for i, number := range []int{numbers[0], numbers[2]} {
+		p, err := store.Get(number)
+		require.NoError(t, err)
+		require.Equal(t, []string{strconv.Itoa(number), "1000", ParcelStatusSent, p.Address, p.CreatedAt}, records[i+1])
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// volumetricDivisor делитель объёмного веса: объём в кубических сантиметрах,
+// делённый на него, даёт объёмный вес в килограммах
+const volumetricDivisor = 5000
+
+// SetDimensions задаёт габариты посылки в сантиметрах
+func (s ParcelStore) SetDimensions(number int, length, width, height float64) error {
+	if length <= 0 || width <= 0 || height <= 0 {
+		return fmt.Errorf("%w: dimensions must be positive: %vx%vx%v", ErrInvalidParcel, length, width, height)
+	}
+
+	query := "UPDATE parcel SET length = :length, width = :width, height = :height, updated_at = :updated_at WHERE number = :number"
+	defer s.observe("SetDimensions", query, time.Now())
+
+	res, err := s.db.Exec(query,
+		sql.Named("length", length),
+		sql.Named("width", width),
+		sql.Named("height", height),
+		sql.Named("updated_at", time.Now().UTC().Format(time.RFC3339)),
+		sql.Named("number", number))
+	if err != nil {
+		return checkClosed(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrParcelNotFound
+	}
+
+	return nil
+}
+
+// GetByVolumetricWeightOver возвращает посылки, объёмный вес которых в килограммах
+// больше threshold. Посылки без габаритов пропускаются
+func (s ParcelStore) GetByVolumetricWeightOver(threshold float64) ([]Parcel, error) {
+	return s.queryParcels("GetByVolumetricWeightOver", `SELECT `+parcelColumns+` FROM parcel
+		WHERE length IS NOT NULL AND width IS NOT NULL AND height IS NOT NULL
+			AND length * width * height / :divisor > :threshold
+		ORDER BY number`,
+		sql.Named("divisor", float64(volumetricDivisor)),
+		sql.Named("threshold", threshold))
+}
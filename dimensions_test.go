@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetByVolumetricWeightOver проверяет отбор посылок по объёмному весу
+func TestGetByVolumetricWeightOver(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	// объёмный вес: 1 кг, 6 кг и 12 кг
+	dims := [][3]float64{{10, 20, 25}, {30, 20, 50}, {40, 30, 50}}
+	numbers := make([]int, len(dims))
+	for i, d := range dims {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+
+		err = store.SetDimensions(id, d[0], d[1], d[2])
+		require.NoError(t, err)
+		numbers[i] = id
+	}
+
+	// посылка без габаритов
+	_, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// check
+	found, err := store.GetByVolumetricWeightOver(5)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, numbers[1], found[0].Number)
+	require.Equal(t, numbers[2], found[1].Number)
+
+	found, err = store.GetByVolumetricWeightOver(0)
+	require.NoError(t, err)
+	require.Len(t, found, 3)
+
+	// errors
+	err = store.SetDimensions(numbers[0], 0, 1, 1)
+	require.ErrorIs(t, err, ErrInvalidParcel)
+
+	err = store.SetDimensions(-1, 1, 1, 1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
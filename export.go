@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// ExportNDJSON записывает в w все посылки в формате ND-JSON: по одному JSON-объекту в строке.
+// Посылки пишутся по мере чтения из БД, вся таблица в памяти не собирается
+func (s ParcelStore) ExportNDJSON(w io.Writer) error {
+	rows, err := s.reader().Query("SELECT " + parcelColumns + " FROM parcel ORDER BY number")
+	if err != nil {
+		return checkClosed(err)
+	}
+	defer rows.Close()
+
+	// Encode дописывает перевод строки после каждого объекта
+	enc := json.NewEncoder(w)
+	for rows.Next() {
+		p, err := scanParcel(rows)
+		if err != nil {
+			return err
+		}
+
+		err = enc.Encode(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// receiptTemplate шаблон квитанции для писем клиентам
+var receiptTemplate = template.Must(template.New("receipt").Parse(`Посылка № {{.Number}}
+Клиент: {{.Client}}
+{{- if .Recipient}}
+Получатель: {{.Recipient}}
+{{- end}}
+Адрес: {{.Address}}
+Статус: {{.Status}}
+Зарегистрирована: {{.CreatedAt}}
+{{- if .CarrierTracking}}
+Трек-номер перевозчика: {{.CarrierTracking}}
+{{- end}}
+`))
+
+// FormatReceipt возвращает квитанцию по посылке number в виде многострочного текста
+func (s ParcelStore) FormatReceipt(number int) (string, error) {
+	p, err := s.Get(number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrParcelNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	err = receiptTemplate.Execute(&buf, p)
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// StatsJSON собирает сводную статистику по посылкам и записывает её в w в формате JSON
+func (s ParcelStore) StatsJSON(w io.Writer) error {
+	stats, err := s.Stats()
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(stats)
+}
+
+// ParcelPage страница списка посылок для ответа API
+type ParcelPage struct {
+	Items   []Parcel `json:"items"`
+	Page    int      `json:"page"`
+	Size    int      `json:"size"`
+	Total   int      `json:"total"`
+	HasMore bool     `json:"has_more"`
+}
+
+// GetByClientJSON записывает в w страницу page (начиная с 1) посылок клиента client
+// по size посылок на странице в виде JSON-объекта ParcelPage.
+// Используется один запрос на количество и один на саму страницу
+func (s ParcelStore) GetByClientJSON(w io.Writer, client, page, size int) error {
+	if page < 1 || size < 1 {
+		return fmt.Errorf("invalid page %d or size %d", page, size)
+	}
+
+	total, err := s.Query().Client(client).Count()
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.reader().Query("SELECT "+parcelColumns+" FROM parcel WHERE client = :client ORDER BY number LIMIT :limit OFFSET :offset",
+		sql.Named("client", client),
+		sql.Named("limit", size),
+		sql.Named("offset", (page-1)*size))
+	if err != nil {
+		return checkClosed(err)
+	}
+	defer rows.Close()
+
+	items, err := scanParcels(rows)
+	if err != nil {
+		return err
+	}
+	if items == nil {
+		// пустая страница кодируется как [], а не null
+		items = []Parcel{}
+	}
+
+	return json.NewEncoder(w).Encode(ParcelPage{
+		Items:   items,
+		Page:    page,
+		Size:    size,
+		Total:   total,
+		HasMore: page*size < total,
+	})
+}
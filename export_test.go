@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestExportNDJSON проверяет, что каждая строка выгрузки — отдельная посылка в JSON
+func TestExportNDJSON(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	parcelMap := map[int]Parcel{}
+	for i := 0; i < 3; i++ {
+		parcel := getTestParcel()
+		parcel.Address = "Псков, \"ул.\" Колотушкина\nд. 5"
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+
+		parcel.Number = id
+		parcelMap[id] = parcel
+	}
+
+	// export
+	var buf bytes.Buffer
+	err := store.ExportNDJSON(&buf)
+	require.NoError(t, err)
+
+	// check
+	scanner := bufio.NewScanner(&buf)
+	lines := 0
+	for scanner.Scan() {
+		lines++
+
+		var parcel Parcel
+		err := json.Unmarshal(scanner.Bytes(), &parcel)
+		require.NoError(t, err)
+		require.Equal(t, parcelMap[parcel.Number], parcel)
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, len(parcelMap), lines)
+}
+
+// TestFormatReceipt проверяет формирование квитанции по посылке
+func TestFormatReceipt(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+	parcel := getTestParcel()
+	parcel.Address = "Псков, ул. Колотушкина, д. 5"
+
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	// format
+	receipt, err := store.FormatReceipt(id)
+	require.NoError(t, err)
+	require.Contains(t, receipt, fmt.Sprintf("Посылка № %d", id))
+	require.Contains(t, receipt, "Клиент: 1000")
+	require.Contains(t, receipt, "Адрес: "+parcel.Address)
+	require.Contains(t, receipt, "Статус: "+ParcelStatusRegistered)
+	require.Contains(t, receipt, "Зарегистрирована: "+parcel.CreatedAt)
+	require.NotContains(t, receipt, "Трек-номер")
+
+	// with carrier tracking
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	require.NoError(t, store.SetCarrierTracking(id, "CR000000042"))
+
+	receipt, err = store.FormatReceipt(id)
+	require.NoError(t, err)
+	require.Contains(t, receipt, "Трек-номер перевозчика: CR000000042")
+
+	_, err = store.FormatReceipt(-1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestStatsJSON проверяет выгрузку сводной статистики в JSON
+func TestStatsJSON(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	seed := []struct {
+		client int
+		status string
+	}{
+		{1, ParcelStatusRegistered},
+		{1, ParcelStatusSent},
+		{2, ParcelStatusSent},
+		{3, ParcelStatusDelivered},
+	}
+	for _, s := range seed {
+		parcel := getTestParcel()
+		parcel.Client = s.client
+		parcel.Status = s.status
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// export
+	var buf bytes.Buffer
+	err := store.StatsJSON(&buf)
+	require.NoError(t, err)
+
+	// check
+	var stats ParcelStats
+	err = json.Unmarshal(buf.Bytes(), &stats)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStats{
+		Total: 4,
+		ByStatus: map[string]int{
+			ParcelStatusRegistered: 1,
+			ParcelStatusSent:       2,
+			ParcelStatusDelivered:  1,
+		},
+		Clients: 3,
+	}, stats)
+}
+
+// TestGetByClientJSON проверяет постраничную выдачу посылок клиента в JSON
+func TestGetByClientJSON(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	numbers, err := store.SeedParcels(1000, 5, `Unit %d, "Quoted" <Street> & Co`)
+	require.NoError(t, err)
+
+	// pages
+	var buf bytes.Buffer
+	err = store.GetByClientJSON(&buf, 1000, 2, 2)
+	require.NoError(t, err)
+
+	var page ParcelPage
+	err = json.Unmarshal(buf.Bytes(), &page)
+	require.NoError(t, err)
+	require.Equal(t, 2, page.Page)
+	require.Equal(t, 2, page.Size)
+	require.Equal(t, 5, page.Total)
+	require.True(t, page.HasMore)
+	require.Len(t, page.Items, 2)
+	require.Equal(t, numbers[2], page.Items[0].Number)
+	require.Equal(t, `Unit 3, "Quoted" <Street> & Co`, page.Items[0].Address)
+
+	buf.Reset()
+	err = store.GetByClientJSON(&buf, 1000, 3, 2)
+	require.NoError(t, err)
+
+	page = ParcelPage{}
+	err = json.Unmarshal(buf.Bytes(), &page)
+	require.NoError(t, err)
+	require.False(t, page.HasMore)
+	require.Len(t, page.Items, 1)
+
+	// пустая страница
+	buf.Reset()
+	err = store.GetByClientJSON(&buf, 2000, 1, 10)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), `"items":[]`)
+
+	err = store.GetByClientJSON(&buf, 1000, 0, 10)
+	require.Error(t, err)
+}
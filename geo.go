@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// SetCoordinates задаёт координаты адреса доставки посылки в градусах
+func (s ParcelStore) SetCoordinates(number int, lat, lon float64) error {
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return fmt.Errorf("%w: coordinates out of range: %v, %v", ErrInvalidParcel, lat, lon)
+	}
+
+	query := "UPDATE parcel SET lat = :lat, lon = :lon, updated_at = :updated_at WHERE number = :number"
+	defer s.observe("SetCoordinates", query, time.Now())
+
+	res, err := s.db.Exec(query,
+		sql.Named("lat", lat),
+		sql.Named("lon", lon),
+		sql.Named("updated_at", time.Now().UTC().Format(time.RFC3339)),
+		sql.Named("number", number))
+	if err != nil {
+		return checkClosed(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrParcelNotFound
+	}
+
+	return nil
+}
+
+// NearestParcels возвращает не более limit посылок, ближайших к точке (lat, lon).
+// Посылки без координат пропускаются. Если задан maxRows, limit ограничивается им.
+// Вместо формулы гаверсинусов используется равнопромежуточная проекция: долгота масштабируется
+// на косинус широты точки. На расстояниях в пределах города порядок получается тем же,
+// переход через 180-й меридиан не учитывается
+func (s ParcelStore) NearestParcels(lat, lon float64, limit int) ([]Parcel, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive, got %d", limit)
+	}
+	if s.maxRows > 0 {
+		limit = min(limit, s.maxRows)
+	}
+
+	// запрос выполняется напрямую, так как queryParcels добавляет собственный LIMIT
+	query := `SELECT ` + parcelColumns + ` FROM parcel
+		WHERE lat IS NOT NULL AND lon IS NOT NULL
+		ORDER BY (lat - :lat) * (lat - :lat) + (lon - :lon) * (lon - :lon) * :scale, number
+		LIMIT :limit`
+	defer s.observe("NearestParcels", query, time.Now())
+
+	rows, err := s.reader().Query(query,
+		sql.Named("lat", lat),
+		sql.Named("lon", lon),
+		sql.Named("scale", math.Pow(math.Cos(lat*math.Pi/180), 2)),
+		sql.Named("limit", limit))
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	return scanParcels(rows)
+}
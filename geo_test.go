@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestNearestParcels проверяет сортировку посылок по удалённости от точки
+func TestNearestParcels(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	// координаты: Москва, Тверь, Санкт-Петербург и посылка без координат
+	coords := [][2]float64{{55.75, 37.62}, {56.86, 35.90}, {59.94, 30.31}}
+	numbers := make([]int, len(coords))
+	for i, c := range coords {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+
+		err = store.SetCoordinates(id, c[0], c[1])
+		require.NoError(t, err)
+		numbers[i] = id
+	}
+
+	_, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// nearest to Великий Новгород: Санкт-Петербург, Тверь, Москва
+	found, err := store.NearestParcels(58.52, 31.27, 10)
+	require.NoError(t, err)
+	require.Len(t, found, 3)
+	require.Equal(t, numbers[2], found[0].Number)
+	require.Equal(t, numbers[1], found[1].Number)
+	require.Equal(t, numbers[0], found[2].Number)
+
+	found, err = store.NearestParcels(55.7, 37.6, 1)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, numbers[0], found[0].Number)
+
+	// limit ограничивается maxRows
+	found, err = store.WithMaxRows(2).NearestParcels(58.52, 31.27, 10)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, numbers[2], found[0].Number)
+	require.Equal(t, numbers[1], found[1].Number)
+
+	// errors
+	_, err = store.NearestParcels(0, 0, 0)
+	require.Error(t, err)
+
+	err = store.SetCoordinates(numbers[0], 91, 0)
+	require.ErrorIs(t, err, ErrInvalidParcel)
+
+	err = store.SetCoordinates(-1, 0, 0)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
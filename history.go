@@ -0,0 +1,204 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StatusEvent запись из истории статусов посылки
+type StatusEvent struct {
+	Status    string
+	ChangedAt string
+	// Reason причина ручного исправления статуса, для обычных переходов пустая
+	Reason string
+}
+
+// WithHistory возвращает копию хранилища, которая записывает изменения статусов
+// в историю (таблицу status_history). Без неё история не ведётся, кроме ручных
+// исправлений через CorrectStatus: их причина хранится только в истории.
+// От истории зависят GetWithHistory, StuckParcels, Funnel, StatusMismatches и другие
+// отчёты, поэтому для них хранилище должно быть создано с WithHistory
+func (s ParcelStore) WithHistory() ParcelStore {
+	s.recordHistory = true
+	return s
+}
+
+// recordStatus добавляет запись в историю статусов, если история включена через WithHistory
+func (s ParcelStore) recordStatus(tx *sql.Tx, number int, status string, changedAt string) error {
+	if !s.recordHistory {
+		return nil
+	}
+	return addStatusEvent(tx, number, status, changedAt, "")
+}
+
+// addStatusEvent добавляет запись в историю статусов посылки в рамках транзакции tx
+func addStatusEvent(tx *sql.Tx, number int, status string, changedAt string, reason string) error {
+	_, err := tx.Exec("INSERT INTO status_history (number, status, changed_at, reason) VALUES (:number, :status, :changed_at, :reason)",
+		sql.Named("number", number),
+		sql.Named("status", status),
+		sql.Named("changed_at", changedAt),
+		sql.Named("reason", reason))
+
+	return err
+}
+
+// GetWithHistory возвращает посылку вместе с историей её статусов.
+// Посылка и история читаются в одной транзакции, история упорядочена от старых записей к новым
+func (s ParcelStore) GetWithHistory(number int) (Parcel, []StatusEvent, error) {
+	tx, err := s.reader().Begin()
+	if err != nil {
+		return Parcel{}, nil, checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow("SELECT "+parcelColumns+" FROM parcel WHERE number = :number",
+		sql.Named("number", number))
+	p, err := scanParcel(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, nil, ErrParcelNotFound
+	}
+	if err != nil {
+		return p, nil, err
+	}
+
+	rows, err := tx.Query("SELECT status, changed_at, reason FROM status_history WHERE number = :number ORDER BY id",
+		sql.Named("number", number))
+	if err != nil {
+		return p, nil, err
+	}
+	defer rows.Close()
+
+	var history []StatusEvent
+	for rows.Next() {
+		e := StatusEvent{}
+
+		err := rows.Scan(&e.Status, &e.ChangedAt, &e.Reason)
+		if err != nil {
+			return p, nil, err
+		}
+
+		history = append(history, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return p, nil, err
+	}
+
+	return p, history, tx.Commit()
+}
+
+// GetStatusHistories возвращает истории статусов сразу для нескольких посылок одним запросом.
+// Для номеров без истории (в том числе несуществующих) в результате будет пустой срез,
+// истории упорядочены от старых записей к новым
+func (s ParcelStore) GetStatusHistories(numbers []int) (map[int][]StatusEvent, error) {
+	histories := make(map[int][]StatusEvent, len(numbers))
+	if len(numbers) == 0 {
+		return histories, nil
+	}
+
+	placeholders := make([]string, len(numbers))
+	args := make([]any, len(numbers))
+	for i, number := range numbers {
+		name := fmt.Sprintf("n%d", i)
+		placeholders[i] = ":" + name
+		args[i] = sql.Named(name, number)
+		histories[number] = []StatusEvent{}
+	}
+
+	rows, err := s.reader().Query("SELECT number, status, changed_at, reason FROM status_history WHERE number IN ("+
+		strings.Join(placeholders, ", ")+") ORDER BY id", args...)
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var number int
+		e := StatusEvent{}
+
+		err := rows.Scan(&number, &e.Status, &e.ChangedAt, &e.Reason)
+		if err != nil {
+			return nil, err
+		}
+
+		histories[number] = append(histories[number], e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return histories, nil
+}
+
+// PurgeHistoryOlderThan удаляет из истории статусов записи, сделанные раньше t,
+// и возвращает количество удалённых записей. Сами посылки не затрагиваются
+func (s ParcelStore) PurgeHistoryOlderThan(t time.Time) (int64, error) {
+	query := "DELETE FROM status_history WHERE changed_at < :before"
+	defer s.observe("PurgeHistoryOlderThan", query, time.Now())
+
+	res, err := s.db.Exec(query,
+		sql.Named("before", t.UTC().Format(time.RFC3339)))
+	if err != nil {
+		return 0, checkClosed(err)
+	}
+
+	return res.RowsAffected()
+}
+
+// StuckParcels возвращает незавершённые (registered или sent) посылки, статус которых
+// не менялся дольше threshold. Время последнего изменения берётся из истории статусов,
+// а если истории нет (она не включена через WithHistory) — из updated_at или created_at
+func (s ParcelStore) StuckParcels(threshold time.Duration) ([]Parcel, error) {
+	before := time.Now().Add(-threshold).UTC().Format(time.RFC3339)
+
+	return s.queryParcels("StuckParcels", `SELECT `+parcelColumnsOf("p")+`
+		FROM parcel p LEFT JOIN status_history h ON h.number = p.number
+		WHERE p.status IN (:registered, :sent)
+		GROUP BY p.number
+		HAVING COALESCE(MAX(h.changed_at), p.updated_at, p.created_at) < :before
+		ORDER BY p.number`,
+		sql.Named("registered", ParcelStatusRegistered),
+		sql.Named("sent", ParcelStatusSent),
+		sql.Named("before", before))
+}
+
+// ActionableParcels возвращает посылки, требующие действий диспетчера:
+// все зарегистрированные (их нужно отправить) и отправленные, статус которых
+// не менялся дольше stuckAfter (по ним нужно связаться с перевозчиком)
+func (s ParcelStore) ActionableParcels(stuckAfter time.Duration) ([]Parcel, error) {
+	before := time.Now().Add(-stuckAfter).UTC().Format(time.RFC3339)
+
+	return s.queryParcels("ActionableParcels", `SELECT `+parcelColumnsOf("p")+`
+		FROM parcel p LEFT JOIN status_history h ON h.number = p.number
+		WHERE p.status IN (:registered, :sent)
+		GROUP BY p.number
+		HAVING p.status = :registered OR COALESCE(MAX(h.changed_at), p.updated_at, p.created_at) < :before
+		ORDER BY p.number`,
+		sql.Named("registered", ParcelStatusRegistered),
+		sql.Named("sent", ParcelStatusSent),
+		sql.Named("before", before))
+}
+
+// ModifiedOutsideWindow возвращает посылки, последнее изменение которых (updated_at)
+// пришлось на время суток вне ежедневного окна обслуживания [windowStart, windowEnd).
+// Из windowStart и windowEnd берётся только время суток по UTC; если windowEnd раньше
+// windowStart, окно переходит через полночь. Посылки, которые не менялись, не проверяются
+func (s ParcelStore) ModifiedOutsideWindow(windowStart, windowEnd time.Time) ([]Parcel, error) {
+	start := windowStart.UTC().Format(time.TimeOnly)
+	end := windowEnd.UTC().Format(time.TimeOnly)
+
+	inside := "time(updated_at) >= :start AND time(updated_at) < :end"
+	if end < start {
+		inside = "(time(updated_at) >= :start OR time(updated_at) < :end)"
+	}
+
+	return s.queryParcels("ModifiedOutsideWindow", `SELECT `+parcelColumns+` FROM parcel
+		WHERE updated_at IS NOT NULL AND NOT (`+inside+`)
+		ORDER BY number`,
+		sql.Named("start", start),
+		sql.Named("end", end))
+}
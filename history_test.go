@@ -0,0 +1,260 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetWithHistory проверяет получение посылки вместе с историей статусов
+func TestGetWithHistory(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db).WithHistory()
+
+	// add
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+
+	// set status
+	err = store.SetStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
+	err = store.SetStatus(id, ParcelStatusDelivered)
+	require.NoError(t, err)
+
+	// get with history
+	parcel, history, err := store.GetWithHistory(id)
+	require.NoError(t, err)
+	require.Equal(t, id, parcel.Number)
+	require.Equal(t, ParcelStatusDelivered, parcel.Status)
+
+	require.Len(t, history, 3)
+	require.Equal(t, ParcelStatusRegistered, history[0].Status)
+	require.Equal(t, ParcelStatusSent, history[1].Status)
+	require.Equal(t, ParcelStatusDelivered, history[2].Status)
+
+	// not found
+	_, _, err = store.GetWithHistory(-1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestStuckParcels проверяет поиск посылок, статус которых давно не менялся
+func TestStuckParcels(t *testing.T) {
+	// без истории время изменения статуса берётся из updated_at
+	t.Run("history", func(t *testing.T) { testStuckParcels(t, NewParcelStore(openTestDB(t)).WithHistory()) })
+	t.Run("plain", func(t *testing.T) { testStuckParcels(t, NewParcelStore(openTestDB(t))) })
+}
+
+func testStuckParcels(t *testing.T, store ParcelStore) {
+	// prepare
+
+	old := getTestParcel()
+	old.CreatedAt = time.Now().Add(-72 * time.Hour).UTC().Format(time.RFC3339)
+
+	stale, err := store.Add(old)
+	require.NoError(t, err)
+
+	// посылка создана давно, но её статус только что изменился
+	recent, err := store.Add(old)
+	require.NoError(t, err)
+	err = store.SetStatus(recent, ParcelStatusSent)
+	require.NoError(t, err)
+
+	// доставленные посылки не считаются зависшими
+	delivered := old
+	delivered.Status = ParcelStatusDelivered
+	_, err = store.Add(delivered)
+	require.NoError(t, err)
+
+	// stuck
+	parcels, err := store.StuckParcels(24 * time.Hour)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	require.Equal(t, stale, parcels[0].Number)
+}
+
+// TestActionableParcels проверяет выбор посылок, требующих действий
+func TestActionableParcels(t *testing.T) {
+	t.Run("history", func(t *testing.T) { testActionableParcels(t, NewParcelStore(openTestDB(t)).WithHistory()) })
+	t.Run("plain", func(t *testing.T) { testActionableParcels(t, NewParcelStore(openTestDB(t))) })
+}
+
+func testActionableParcels(t *testing.T, store ParcelStore) {
+	// prepare
+	registered, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	freshSent := getTestParcel()
+	freshSent.Status = ParcelStatusSent
+	_, err = store.Add(freshSent)
+	require.NoError(t, err)
+
+	oldSent := getTestParcel()
+	oldSent.Status = ParcelStatusSent
+	oldSent.CreatedAt = time.Now().Add(-72 * time.Hour).UTC().Format(time.RFC3339)
+	stuck, err := store.Add(oldSent)
+	require.NoError(t, err)
+
+	// давно созданная посылка, отправленная только что, не зависла
+	oldRegistered := oldSent
+	oldRegistered.Status = ParcelStatusRegistered
+	recent, err := store.Add(oldRegistered)
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(recent, ParcelStatusSent))
+
+	delivered := oldSent
+	delivered.Status = ParcelStatusDelivered
+	_, err = store.Add(delivered)
+	require.NoError(t, err)
+
+	// actionable
+	parcels, err := store.ActionableParcels(24 * time.Hour)
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	require.Equal(t, registered, parcels[0].Number)
+	require.Equal(t, stuck, parcels[1].Number)
+}
+
+// TestGetStatusHistories проверяет получение историй статусов для нескольких посылок
+func TestGetStatusHistories(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t)).WithHistory()
+
+	first, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	err = store.SetStatus(first, ParcelStatusSent)
+	require.NoError(t, err)
+	err = store.SetStatus(first, ParcelStatusDelivered)
+	require.NoError(t, err)
+
+	second, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// get
+	histories, err := store.GetStatusHistories([]int{first, second, -1})
+	require.NoError(t, err)
+	require.Len(t, histories, 3)
+
+	require.Len(t, histories[first], 3)
+	require.Equal(t, ParcelStatusRegistered, histories[first][0].Status)
+	require.Equal(t, ParcelStatusDelivered, histories[first][2].Status)
+
+	require.Len(t, histories[second], 1)
+	require.Equal(t, ParcelStatusRegistered, histories[second][0].Status)
+
+	require.NotNil(t, histories[-1])
+	require.Empty(t, histories[-1])
+
+	histories, err = store.GetStatusHistories(nil)
+	require.NoError(t, err)
+	require.Empty(t, histories)
+}
+
+// TestPurgeHistoryOlderThan проверяет удаление старых записей истории статусов
+func TestPurgeHistoryOlderThan(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db).WithHistory()
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	old := time.Now().AddDate(-1, 0, 0).UTC().Format(time.RFC3339)
+	for _, status := range []string{ParcelStatusRegistered, ParcelStatusSent} {
+		_, err = db.Exec("INSERT INTO status_history (number, status, changed_at, reason) VALUES (?, ?, ?, '')",
+			id, status, old)
+		require.NoError(t, err)
+	}
+
+	// purge
+	n, err := store.PurgeHistoryOlderThan(time.Now().AddDate(0, -1, 0))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+
+	// check
+	p, history, err := store.GetWithHistory(id)
+	require.NoError(t, err)
+	require.Equal(t, id, p.Number)
+	require.Len(t, history, 1)
+	require.NotEqual(t, old, history[0].ChangedAt)
+}
+
+// TestWithHistory проверяет, что история статусов ведётся только в хранилище с WithHistory
+func TestWithHistory(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	plain := NewParcelStore(db)
+	withHistory := plain.WithHistory()
+
+	countHistory := func(number int) int {
+		var n int
+		err := db.QueryRow("SELECT COUNT(*) FROM status_history WHERE number = ?", number).Scan(&n)
+		require.NoError(t, err)
+		return n
+	}
+
+	// plain
+	id, err := plain.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, plain.SetStatus(id, ParcelStatusSent))
+	require.Equal(t, 0, countHistory(id))
+
+	// ручное исправление записывается всегда
+	require.NoError(t, plain.CorrectStatus(id, ParcelStatusRegistered, "sent by mistake"))
+	require.Equal(t, 1, countHistory(id))
+
+	// with history
+	id, err = withHistory.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, withHistory.SetStatus(id, ParcelStatusSent))
+	require.Equal(t, 2, countHistory(id))
+}
+
+// TestModifiedOutsideWindow проверяет поиск посылок, изменённых вне окна обслуживания
+func TestModifiedOutsideWindow(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	updates := []string{
+		"2024-03-01T02:30:00Z", // внутри окна 02:00-04:00
+		"2024-03-01T12:00:00Z", // вне окна
+		"2024-03-02T23:30:00Z", // внутри окна 23:00-01:00
+		"",                     // не менялась
+	}
+	numbers := make([]int, len(updates))
+	for i, updatedAt := range updates {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers[i] = id
+
+		if updatedAt != "" {
+			_, err = db.Exec("UPDATE parcel SET updated_at = ? WHERE number = ?", updatedAt, id)
+			require.NoError(t, err)
+		}
+	}
+
+	at := func(hour int) time.Time {
+		return time.Date(2024, time.January, 1, hour, 0, 0, 0, time.UTC)
+	}
+
+	// check
+	found, err := store.ModifiedOutsideWindow(at(2), at(4))
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, numbers[1], found[0].Number)
+	require.Equal(t, numbers[2], found[1].Number)
+
+	// окно через полночь
+	found, err = store.ModifiedOutsideWindow(at(23), at(1))
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, numbers[0], found[0].Number)
+	require.Equal(t, numbers[1], found[1].Number)
+}
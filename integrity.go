@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// CheckIntegrity проверяет все посылки в таблице и возвращает описания найденных ошибок:
+// пустые адреса, неизвестные статусы, неположительные идентификаторы клиентов
+// и created_at не в формате RFC3339. Нужен, чтобы находить данные,
+// попавшие в БД в обход хранилища
+func (s ParcelStore) CheckIntegrity() ([]string, error) {
+	rows, err := s.reader().Query("SELECT " + parcelColumns + " FROM parcel ORDER BY number")
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	var issues []string
+	for rows.Next() {
+		p, err := scanParcel(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, problem := range parcelProblems(p) {
+			issues = append(issues, fmt.Sprintf("parcel %d: %s", p.Number, problem))
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return issues, nil
+}
+
+// ReconcileSequence поднимает счётчик autoincrement таблицы parcel до максимального номера посылки.
+// SQLite сам увеличивает счётчик при вставке номера вручную, но он может отстать, если таблицу
+// перезаписали в обход хранилища или восстановили из копии. Счётчик никогда не уменьшается,
+// чтобы номера удалённых посылок не выдавались повторно
+func (s ParcelStore) ReconcileSequence() error {
+	defer s.observe("ReconcileSequence", "", time.Now())
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	_, err = reconcileSequence(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// reconcileSequence поднимает счётчик autoincrement таблицы parcel в транзакции tx
+// и сообщает, пришлось ли его менять
+func reconcileSequence(tx *sql.Tx) (bool, error) {
+	var maxNumber, seq int
+	err := tx.QueryRow(`SELECT COALESCE(MAX(number), 0),
+		COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'parcel'), 0) FROM parcel`).Scan(&maxNumber, &seq)
+	if err != nil {
+		return false, err
+	}
+	if seq >= maxNumber {
+		return false, nil
+	}
+
+	res, err := tx.Exec("UPDATE sqlite_sequence SET seq = :max WHERE name = 'parcel'",
+		sql.Named("max", maxNumber))
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	// строки для таблицы ещё нет, если в неё ни разу не вставляли
+	if n == 0 {
+		_, err = tx.Exec("INSERT INTO sqlite_sequence (name, seq) VALUES ('parcel', :max)",
+			sql.Named("max", maxNumber))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// StatusMismatches возвращает посылки, текущий статус которых не совпадает с последней
+// записью в истории статусов. Такое бывает, если статус изменили в обход хранилища.
+// Посылки без истории не проверяются
+func (s ParcelStore) StatusMismatches() ([]Parcel, error) {
+	return s.queryParcels("StatusMismatches", `SELECT `+parcelColumnsOf("p")+`
+		FROM parcel p JOIN status_history h ON h.number = p.number
+		WHERE h.id = (SELECT MAX(id) FROM status_history WHERE number = p.number)
+			AND h.status <> p.status
+		ORDER BY p.number`)
+}
+
+// TableChecksum возвращает контрольную сумму всех посылок (SHA-256 в hex), чтобы дёшево
+// сравнивать содержимое двух БД. Посылки берутся в порядке номеров, в сумму входят
+// все поля Parcel. Служебные колонки вроде updated_at не учитываются
+func (s ParcelStore) TableChecksum() (string, error) {
+	rows, err := s.reader().Query("SELECT " + parcelColumns + " FROM parcel ORDER BY number")
+	if err != nil {
+		return "", checkClosed(err)
+	}
+	defer rows.Close()
+
+	h := sha256.New()
+	for rows.Next() {
+		p, err := scanParcel(rows)
+		if err != nil {
+			return "", err
+		}
+
+		// %q экранирует строки, поэтому разделители внутри значений не дают совпадений
+		fmt.Fprintf(h, "%d %d %q %q %q %q %q\n",
+			p.Number, p.Client, p.Status, p.Address, p.CreatedAt, p.CarrierTracking, p.Recipient)
+	}
+
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// InvalidHistories проверяет историю статусов каждой посылки и возвращает истории,
+// в которых есть недопустимый переход, например delivered -> registered.
+// Записи с причиной сделаны через CorrectStatus и считаются допустимыми
+func (s ParcelStore) InvalidHistories() (map[int][]StatusEvent, error) {
+	rows, err := s.reader().Query("SELECT number, status, changed_at, reason FROM status_history ORDER BY number, id")
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	histories := map[int][]StatusEvent{}
+	for rows.Next() {
+		var number int
+		e := StatusEvent{}
+
+		err := rows.Scan(&number, &e.Status, &e.ChangedAt, &e.Reason)
+		if err != nil {
+			return nil, err
+		}
+
+		histories[number] = append(histories[number], e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for number, history := range histories {
+		if validHistory(history) {
+			delete(histories, number)
+		}
+	}
+
+	return histories, nil
+}
+
+// validHistory проверяет, что все переходы в истории допустимы
+func validHistory(history []StatusEvent) bool {
+	for i := 1; i < len(history); i++ {
+		if history[i].Reason != "" {
+			continue
+		}
+		if !CanTransition(history[i-1].Status, history[i].Status) {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyCreatedAtOrdering проверяет, что created_at посылок клиента client не убывает
+// с ростом номера, и возвращает номера посылок, созданных раньше какой-либо посылки
+// с меньшим номером
+func (s ParcelStore) VerifyCreatedAtOrdering(client int) ([]int, error) {
+	rows, err := s.reader().Query("SELECT number, created_at FROM parcel WHERE client = :client ORDER BY number",
+		sql.Named("client", client))
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	var violations []int
+	var latest string
+	for rows.Next() {
+		var number int
+		var createdAt string
+
+		err := rows.Scan(&number, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		// created_at хранится в UTC в формате RFC3339, поэтому строки можно сравнивать напрямую
+		if createdAt < latest {
+			violations = append(violations, number)
+			continue
+		}
+		latest = createdAt
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return violations, nil
+}
+
+// FutureDatedParcels возвращает посылки, у которых created_at позже текущего времени,
+// упорядоченные по номеру. Такие посылки появляются из-за расхождения часов или
+// ошибок при загрузке данных
+func (s ParcelStore) FutureDatedParcels() ([]Parcel, error) {
+	return s.queryParcels("FutureDatedParcels", "SELECT "+parcelColumns+" FROM parcel WHERE created_at > :now ORDER BY number",
+		sql.Named("now", time.Now().UTC().Format(time.RFC3339)))
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestCheckIntegrity проверяет обнаружение некорректных строк, добавленных в обход хранилища
+func TestCheckIntegrity(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	_, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	issues, err := store.CheckIntegrity()
+	require.NoError(t, err)
+	require.Empty(t, issues)
+
+	// add bad row
+	res, err := db.Exec("INSERT INTO parcel (client, status, address, created_at) VALUES (0, 'lost', '', 'yesterday')")
+	require.NoError(t, err)
+	id, err := res.LastInsertId()
+	require.NoError(t, err)
+
+	// check
+	issues, err = store.CheckIntegrity()
+	require.NoError(t, err)
+	require.Len(t, issues, 4)
+	for _, issue := range issues {
+		require.Contains(t, issue, fmt.Sprintf("parcel %d:", id))
+	}
+}
+
+// TestReconcileSequence проверяет восстановление счётчика autoincrement после ручной вставки номеров
+func TestReconcileSequence(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	manual := 5000
+	_, err := store.WithNumberGenerator(func() int { return manual }).Add(getTestParcel())
+	require.NoError(t, err)
+
+	// счётчик отстал, например после восстановления таблицы из копии
+	_, err = db.Exec("UPDATE sqlite_sequence SET seq = 1 WHERE name = 'parcel'")
+	require.NoError(t, err)
+
+	// reconcile
+	err = store.ReconcileSequence()
+	require.NoError(t, err)
+
+	// add
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.Greater(t, id, manual)
+}
+
+// TestStatusMismatches проверяет поиск посылок, статус которых расходится с историей
+func TestStatusMismatches(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db).WithHistory()
+
+	ok, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(ok, ParcelStatusSent))
+
+	bad, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	mismatches, err := store.StatusMismatches()
+	require.NoError(t, err)
+	require.Empty(t, mismatches)
+
+	// статус меняется в обход хранилища, история не пишется
+	_, err = db.Exec("UPDATE parcel SET status = ? WHERE number = ?", ParcelStatusDelivered, bad)
+	require.NoError(t, err)
+
+	// check
+	mismatches, err = store.StatusMismatches()
+	require.NoError(t, err)
+	require.Len(t, mismatches, 1)
+	require.Equal(t, bad, mismatches[0].Number)
+	require.Equal(t, ParcelStatusDelivered, mismatches[0].Status)
+}
+
+// TestTableChecksum проверяет, что одинаковые данные дают одинаковую контрольную сумму
+func TestTableChecksum(t *testing.T) {
+	// prepare
+	first := NewParcelStore(openTestDB(t))
+	second := NewParcelStore(openTestDB(t))
+
+	parcel := getTestParcel()
+	parcel.CreatedAt = "2024-01-02T03:04:05Z"
+
+	var ids []int
+	for _, store := range []ParcelStore{first, second} {
+		for i := 0; i < 3; i++ {
+			id, err := store.Add(parcel)
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+	}
+
+	// check
+	sum1, err := first.TableChecksum()
+	require.NoError(t, err)
+	sum2, err := second.TableChecksum()
+	require.NoError(t, err)
+	require.Equal(t, sum1, sum2)
+
+	err = second.SetAddress(ids[len(ids)-1], "another address")
+	require.NoError(t, err)
+
+	sum2, err = second.TableChecksum()
+	require.NoError(t, err)
+	require.NotEqual(t, sum1, sum2)
+}
+
+// TestInvalidHistories проверяет поиск историй статусов с недопустимыми переходами
+func TestInvalidHistories(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db).WithHistory()
+
+	ok, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(ok, ParcelStatusSent))
+	require.NoError(t, store.SetStatus(ok, ParcelStatusDelivered))
+	require.NoError(t, store.CorrectStatus(ok, ParcelStatusSent, "delivered by mistake"))
+
+	bad, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(bad, ParcelStatusSent))
+
+	invalid, err := store.InvalidHistories()
+	require.NoError(t, err)
+	require.Empty(t, invalid)
+
+	// переход sent -> registered в обход хранилища
+	_, err = db.Exec("INSERT INTO status_history (number, status, changed_at, reason) VALUES (?, ?, ?, '')",
+		bad, ParcelStatusRegistered, "2024-01-01T00:00:00Z")
+	require.NoError(t, err)
+
+	// check
+	invalid, err = store.InvalidHistories()
+	require.NoError(t, err)
+	require.Len(t, invalid, 1)
+	require.Len(t, invalid[bad], 3)
+	require.Equal(t, ParcelStatusRegistered, invalid[bad][2].Status)
+}
+
+// TestVerifyCreatedAtOrdering проверяет поиск посылок клиента с нарушенным порядком created_at
+func TestVerifyCreatedAtOrdering(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	createdAt := []string{
+		"2024-03-01T10:00:00Z",
+		"2024-03-01T10:00:00Z",
+		"2024-03-02T10:00:00Z",
+		"2024-03-03T10:00:00Z",
+	}
+	numbers := make([]int, len(createdAt))
+	for i, c := range createdAt {
+		parcel := getTestParcel()
+		parcel.CreatedAt = c
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers[i] = id
+	}
+
+	violations, err := store.VerifyCreatedAtOrdering(1000)
+	require.NoError(t, err)
+	require.Empty(t, violations)
+
+	// дата в обход хранилища оказывается раньше предыдущей посылки
+	_, err = db.Exec("UPDATE parcel SET created_at = ? WHERE number = ?", "2024-02-01T10:00:00Z", numbers[2])
+	require.NoError(t, err)
+
+	// check
+	violations, err = store.VerifyCreatedAtOrdering(1000)
+	require.NoError(t, err)
+	require.Equal(t, []int{numbers[2]}, violations)
+}
+
+// TestFutureDatedParcels проверяет поиск посылок с датой создания в будущем
+func TestFutureDatedParcels(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	_, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	future := getTestParcel()
+	future.CreatedAt = time.Now().UTC().Add(48 * time.Hour).Format(time.RFC3339)
+	id, err := store.Add(future)
+	require.NoError(t, err)
+
+	// check
+	parcels, err := store.FutureDatedParcels()
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	require.Equal(t, id, parcels[0].Number)
+}
@@ -0,0 +1,40 @@
+//go:build go1.23
+
+package main
+
+import (
+	"database/sql"
+	"iter"
+)
+
+// Iter возвращает итератор по посылкам клиента client в порядке номеров, как GetByClient.
+// Посылки читаются из БД по мере обхода, поэтому ограничение maxRows не действует и количество
+// посылок не ограничено; при ошибке она передаётся вторым значением и обход завершается.
+// Если обход прерван раньше, строки результата закрываются
+func (s ParcelStore) Iter(client int) iter.Seq2[Parcel, error] {
+	return func(yield func(Parcel, error) bool) {
+		rows, err := s.reader().Query("SELECT "+parcelColumns+" FROM parcel WHERE client = :client ORDER BY number",
+			sql.Named("client", client))
+		if err != nil {
+			yield(Parcel{}, checkClosed(err))
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			p, err := scanParcel(rows)
+			if err != nil {
+				yield(Parcel{}, err)
+				return
+			}
+
+			if !yield(p, nil) {
+				return
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			yield(Parcel{}, err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+//go:build go1.23
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestIter проверяет обход посылок клиента итератором с досрочным выходом
+func TestIter(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	// с одним соединением незакрытые строки заблокировали бы следующий запрос
+	db.SetMaxOpenConns(1)
+	store := NewParcelStore(db)
+
+	client := 1000
+	numbers, err := store.SeedParcels(client, 5, "Unit %d")
+	require.NoError(t, err)
+
+	// посылка другого клиента в обход не попадает
+	other := getTestParcel()
+	other.Client = 2000
+	_, err = store.Add(other)
+	require.NoError(t, err)
+
+	// iterate
+	var got []Parcel
+	for p, err := range store.Iter(client) {
+		require.NoError(t, err)
+		got = append(got, p)
+		if len(got) == 2 {
+			break
+		}
+	}
+	require.Len(t, got, 2)
+	require.Equal(t, numbers[0], got[0].Number)
+	require.Equal(t, numbers[1], got[1].Number)
+
+	// полный обход совпадает с GetByClient
+	got = got[:0]
+	for p, err := range store.Iter(client) {
+		require.NoError(t, err)
+		got = append(got, p)
+	}
+
+	parcels, err := store.GetByClient(client)
+	require.NoError(t, err)
+	require.Len(t, parcels, len(numbers))
+	require.Equal(t, parcels, got)
+}
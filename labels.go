@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrEmptyLabel возвращается при попытке добавить пустую метку
+var ErrEmptyLabel = errors.New("label must not be empty")
+
+// AddLabel добавляет посылке метку label, например "fragile" или "priority".
+// Повторное добавление той же метки ничего не меняет
+func (s ParcelStore) AddLabel(number int, label string) error {
+	defer s.observe("AddLabel", "", time.Now())
+
+	if strings.TrimSpace(label) == "" {
+		return ErrEmptyLabel
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	_, err = getStatus(tx, number)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT OR IGNORE INTO parcel_labels (number, label) VALUES (:number, :label)",
+		sql.Named("number", number),
+		sql.Named("label", label))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveLabel снимает с посылки метку label. Если метки у посылки нет, ничего не происходит
+func (s ParcelStore) RemoveLabel(number int, label string) error {
+	query := "DELETE FROM parcel_labels WHERE number = :number AND label = :label"
+	defer s.observe("RemoveLabel", query, time.Now())
+
+	_, err := s.db.Exec(query,
+		sql.Named("number", number),
+		sql.Named("label", label))
+
+	return checkClosed(err)
+}
+
+// GetByLabel возвращает посылки с меткой label, упорядоченные по номеру
+func (s ParcelStore) GetByLabel(label string) ([]Parcel, error) {
+	return s.queryParcels("GetByLabel", `SELECT `+parcelColumnsOf("p")+`
+		FROM parcel p JOIN parcel_labels l ON l.number = p.number
+		WHERE l.label = :label ORDER BY p.number`,
+		sql.Named("label", label))
+}
+
+// GetByLabels возвращает посылки, у которых есть все метки из labels, упорядоченные по номеру.
+// Повторяющиеся метки учитываются один раз, для пустого labels возвращаются все посылки
+func (s ParcelStore) GetByLabels(labels []string) ([]Parcel, error) {
+	if len(labels) == 0 {
+		return s.Query().All()
+	}
+
+	var placeholders []string
+	var args []any
+	seen := map[string]bool{}
+	for _, label := range labels {
+		if seen[label] {
+			continue
+		}
+		seen[label] = true
+
+		name := fmt.Sprintf("l%d", len(args))
+		placeholders = append(placeholders, ":"+name)
+		args = append(args, sql.Named(name, label))
+	}
+	args = append(args, sql.Named("count", len(seen)))
+
+	return s.queryParcels("GetByLabels", `SELECT `+parcelColumnsOf("p")+`
+		FROM parcel p JOIN parcel_labels l ON l.number = p.number
+		WHERE l.label IN (`+strings.Join(placeholders, ", ")+`)
+		GROUP BY p.number
+		HAVING COUNT(DISTINCT l.label) = :count
+		ORDER BY p.number`, args...)
+}
+
+// ParcelWithLabels посылка вместе с её метками
+type ParcelWithLabels struct {
+	Parcel
+	Labels []string
+}
+
+// GetWithLabels возвращает посылки клиента client вместе с их метками одним запросом.
+// У посылок без меток Labels — пустой срез. Ограничение maxRows относится к посылкам,
+// а не к строкам соединения: при превышении возвращаются первые maxRows посылок и ErrTooManyRows
+func (s ParcelStore) GetWithLabels(client int) ([]ParcelWithLabels, error) {
+	numbers := "SELECT number FROM parcel WHERE client = :client"
+	if s.maxRows > 0 {
+		// лишняя посылка нужна, чтобы отличить ровно maxRows посылок от обрезанного результата
+		numbers += fmt.Sprintf(" ORDER BY number LIMIT %d", s.maxRows+1)
+	}
+	query := `SELECT ` + parcelColumnsOf("p") + `, l.label
+		FROM parcel p LEFT JOIN parcel_labels l ON l.number = p.number
+		WHERE p.number IN (` + numbers + `) ORDER BY p.number, l.label`
+	defer s.observe("GetWithLabels", query, time.Now())
+
+	rows, err := s.reader().Query(query, sql.Named("client", client))
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	var res []ParcelWithLabels
+	for rows.Next() {
+		p := Parcel{}
+		var label sql.NullString
+
+		err := rows.Scan(&p.Number, &p.Client, &p.Status, &p.Address, &p.CreatedAt, &p.CarrierTracking, &p.Recipient, &label)
+		if err != nil {
+			return nil, err
+		}
+
+		// строки одной посылки идут подряд, так как отсортированы по номеру
+		if len(res) == 0 || res[len(res)-1].Number != p.Number {
+			res = append(res, ParcelWithLabels{Parcel: p, Labels: []string{}})
+		}
+		if label.Valid {
+			last := &res[len(res)-1]
+			last.Labels = append(last.Labels, label.String)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if s.maxRows > 0 && len(res) > s.maxRows {
+		return res[:s.maxRows], fmt.Errorf("%w: result is limited to %d parcels", ErrTooManyRows, s.maxRows)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestLabels проверяет добавление, повторное добавление, удаление меток и поиск по ним
+func TestLabels(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	first, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	second, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// add
+	err = store.AddLabel(first, "fragile")
+	require.NoError(t, err)
+	err = store.AddLabel(second, "fragile")
+	require.NoError(t, err)
+	err = store.AddLabel(second, "priority")
+	require.NoError(t, err)
+
+	// duplicate add
+	err = store.AddLabel(first, "fragile")
+	require.NoError(t, err)
+
+	parcels, err := store.GetByLabel("fragile")
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	require.Equal(t, first, parcels[0].Number)
+	require.Equal(t, second, parcels[1].Number)
+
+	// remove
+	err = store.RemoveLabel(first, "fragile")
+	require.NoError(t, err)
+
+	parcels, err = store.GetByLabel("fragile")
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	require.Equal(t, second, parcels[0].Number)
+
+	parcels, err = store.GetByLabel("priority")
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+
+	// invalid
+	err = store.AddLabel(first, " ")
+	require.ErrorIs(t, err, ErrEmptyLabel)
+	err = store.AddLabel(-1, "fragile")
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestGetWithLabels проверяет получение посылок клиента вместе с метками
+func TestGetWithLabels(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	first, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	second, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	third, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	require.NoError(t, store.AddLabel(first, "priority"))
+	require.NoError(t, store.AddLabel(first, "fragile"))
+	require.NoError(t, store.AddLabel(third, "fragile"))
+
+	// get with labels
+	parcels, err := store.GetWithLabels(1000)
+	require.NoError(t, err)
+	require.Len(t, parcels, 3)
+
+	require.Equal(t, first, parcels[0].Number)
+	require.Equal(t, []string{"fragile", "priority"}, parcels[0].Labels)
+
+	require.Equal(t, second, parcels[1].Number)
+	require.NotNil(t, parcels[1].Labels)
+	require.Empty(t, parcels[1].Labels)
+
+	require.Equal(t, third, parcels[2].Number)
+	require.Equal(t, []string{"fragile"}, parcels[2].Labels)
+}
+
+// TestGetByLabels проверяет поиск посылок, у которых есть все заданные метки
+func TestGetByLabels(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	labels := [][]string{
+		{"fragile"},
+		{"fragile", "priority"},
+		{"fragile", "priority", "oversize"},
+		{"priority"},
+		{},
+	}
+	numbers := make([]int, len(labels))
+	for i, set := range labels {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers[i] = id
+
+		for _, label := range set {
+			require.NoError(t, store.AddLabel(id, label))
+		}
+	}
+
+	// check
+	parcels, err := store.GetByLabels([]string{"fragile", "priority"})
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	require.Equal(t, numbers[1], parcels[0].Number)
+	require.Equal(t, numbers[2], parcels[1].Number)
+
+	parcels, err = store.GetByLabels([]string{"priority", "oversize", "priority"})
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	require.Equal(t, numbers[2], parcels[0].Number)
+
+	parcels, err = store.GetByLabels([]string{"fragile", "missing"})
+	require.NoError(t, err)
+	require.Empty(t, parcels)
+
+	parcels, err = store.GetByLabels(nil)
+	require.NoError(t, err)
+	require.Len(t, parcels, len(labels))
+}
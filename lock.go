@@ -0,0 +1,33 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// GetForUpdate читает посылку в транзакции вызывающего кода tx и блокирует её
+// от изменения другими транзакциями до завершения tx.
+// В SQLite нет SELECT ... FOR UPDATE и блокировок отдельных строк, поэтому
+// перед чтением выполняется UPDATE, не затрагивающий строк (и поэтому не меняющий seq):
+// он всё равно берёт блокировку на запись всей БД,
+// как BEGIN IMMEDIATE. Другие транзакции, пытающиеся писать, ждут busy_timeout
+// и получают ошибку database is locked, если tx не завершилась за это время.
+// Читать БД другие соединения при этом могут
+func (s ParcelStore) GetForUpdate(tx *sql.Tx, number int) (Parcel, error) {
+	_, err := tx.Exec("UPDATE parcel SET number = number WHERE 0")
+	if err != nil {
+		return Parcel{}, err
+	}
+
+	row := tx.QueryRow("SELECT "+parcelColumns+" FROM parcel WHERE number = :number",
+		sql.Named("number", number))
+	p, err := scanParcel(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, ErrParcelNotFound
+	}
+	if err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
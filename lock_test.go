@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetForUpdate проверяет, что вторая транзакция ждёт завершения первой
+func TestGetForUpdate(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// lock
+	tx1, err := db.Begin()
+	require.NoError(t, err)
+	defer tx1.Rollback()
+
+	p, err := store.GetForUpdate(tx1, id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusRegistered, p.Status)
+
+	done := make(chan error, 1)
+	go func() {
+		tx2, err := db.Begin()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer tx2.Rollback()
+
+		p, err := store.GetForUpdate(tx2, id)
+		if err == nil && p.Status != ParcelStatusSent {
+			err = ErrWrongStatus
+		}
+		if err == nil {
+			err = tx2.Commit()
+		}
+		done <- err
+	}()
+
+	// вторая транзакция ждёт, пока первая не завершится
+	select {
+	case err := <-done:
+		t.Fatalf("second transaction was not blocked: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	_, err = tx1.Exec("UPDATE parcel SET status = ? WHERE number = ?", ParcelStatusSent, id)
+	require.NoError(t, err)
+	require.NoError(t, tx1.Commit())
+
+	// после завершения первой вторая видит её изменения
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("second transaction is still blocked")
+	}
+
+	// not found
+	tx3, err := db.Begin()
+	require.NoError(t, err)
+	defer tx3.Rollback()
+
+	_, err = store.GetForUpdate(tx3, -1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
@@ -12,14 +12,21 @@ const (
 	ParcelStatusRegistered = "registered"
 	ParcelStatusSent       = "sent"
 	ParcelStatusDelivered  = "delivered"
+	// ParcelStatusQuarantine служебный статус посылок, у которых Repair обнаружил неизвестный статус.
+	// Переходов из него нет, такие посылки разбираются вручную через CorrectStatus
+	ParcelStatusQuarantine = "quarantine"
 )
 
 type Parcel struct {
-	Number    int
-	Client    int
-	Status    string
-	Address   string
-	CreatedAt string
+	Number    int    `json:"number"`
+	Client    int    `json:"client"`
+	Status    string `json:"status"`
+	Address   string `json:"address"`
+	CreatedAt string `json:"created_at"`
+	// CarrierTracking трек-номер у перевозчика, задаётся через SetCarrierTracking после отправки
+	CarrierTracking string `json:"carrier_tracking,omitempty"`
+	// Recipient имя получателя, может быть не указано
+	Recipient string `json:"recipient,omitempty"`
 }
 
 type ParcelService struct {
@@ -97,9 +104,27 @@ func (s ParcelService) Delete(number int) error {
 }
 
 func main() {
-	// настройте подключение к БД
+	db, err := sql.Open("sqlite", "tracker.db")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer db.Close()
+
+	store := NewParcelStore(db).WithHistory()
+
+	err = store.EnsureSchema()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	err = store.Migrate(LatestSchemaVersion())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 
-	store := // создайте объект ParcelStore функцией NewParcelStore
 	service := NewParcelService(store)
 
 	// регистрация посылки
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSchemaNotInitialized возвращается, если миграция запущена до EnsureSchema
+var ErrSchemaNotInitialized = errors.New("schema is not initialized")
+
+// migrations шаги миграции схемы.
+// migrations[i] переводит схему из версии baseSchemaVersion+i в следующую.
+// Новые шаги добавляются только в конец, уже выпущенные шаги не меняются
+var migrations = []string{
+	// 2: время последнего изменения посылки
+	`ALTER TABLE parcel ADD COLUMN updated_at text`,
+	// 3: трек-номер у перевозчика
+	`ALTER TABLE parcel ADD COLUMN carrier_tracking text not null default ''`,
+	// 4: поиск посылки по трек-номеру перевозчика
+	`CREATE INDEX parcel_carrier_tracking_idx ON parcel (carrier_tracking)`,
+	// 5: получатель посылки
+	`ALTER TABLE parcel ADD COLUMN recipient text not null default ''`,
+	// 6, 7: координаты адреса доставки, NULL — координаты не заданы
+	`ALTER TABLE parcel ADD COLUMN lat real`,
+	`ALTER TABLE parcel ADD COLUMN lon real`,
+	// 8: обработчик, взявший посылку в работу
+	`ALTER TABLE parcel ADD COLUMN claimed_by text not null default ''`,
+	// 9-11: габариты посылки в сантиметрах, NULL — габариты не заданы
+	`ALTER TABLE parcel ADD COLUMN length real`,
+	`ALTER TABLE parcel ADD COLUMN width real`,
+	`ALTER TABLE parcel ADD COLUMN height real`,
+	// 12-16: порядковый номер последнего изменения посылки, общий для всей таблицы.
+	// Счётчик хранится в parcel_change_seq и увеличивается триггерами при каждой вставке
+	// и изменении; условие WHEN не даёт триггеру сработать на собственный UPDATE
+	`ALTER TABLE parcel ADD COLUMN seq integer`,
+	`CREATE TABLE parcel_change_seq (id integer primary key check (id = 1), value integer not null)`,
+	`CREATE TRIGGER parcel_seq_insert AFTER INSERT ON parcel
+	BEGIN
+		INSERT INTO parcel_change_seq (id, value) VALUES (1, 1) ON CONFLICT (id) DO UPDATE SET value = value + 1;
+		UPDATE parcel SET seq = (SELECT value FROM parcel_change_seq WHERE id = 1) WHERE number = NEW.number;
+	END`,
+	`CREATE TRIGGER parcel_seq_update AFTER UPDATE ON parcel WHEN NEW.seq IS OLD.seq
+	BEGIN
+		INSERT INTO parcel_change_seq (id, value) VALUES (1, 1) ON CONFLICT (id) DO UPDATE SET value = value + 1;
+		UPDATE parcel SET seq = (SELECT value FROM parcel_change_seq WHERE id = 1) WHERE number = NEW.number;
+	END`,
+	`CREATE INDEX parcel_seq_idx ON parcel (seq)`,
+	// 17: номера удалённых посылок, чтобы их не путали с новыми
+	`CREATE TABLE parcel_tombstones (number integer primary key, deleted_at text not null)`,
+	// 18: история смены клиента посылки
+	`CREATE TABLE client_history (
+		id integer primary key autoincrement,
+		number integer not null,
+		old_client integer not null,
+		new_client integer not null,
+		changed_at text not null,
+		reason text not null default ''
+	)`,
+	// 19, 20: накопительные счётчики; shipped_total заполняется по уже отправленным посылкам
+	`CREATE TABLE counters (name text primary key, value integer not null)`,
+	`INSERT INTO counters (name, value)
+		SELECT 'shipped_total', COUNT(*) FROM parcel WHERE status IN ('sent', 'delivered')`,
+	// 21: время, когда обработчик взял посылку в работу
+	`ALTER TABLE parcel ADD COLUMN claimed_at text`,
+	// 22: для взятых до появления claimed_at посылок берём время последнего изменения
+	`UPDATE parcel SET claimed_at = COALESCE(updated_at, created_at) WHERE claimed_by <> '' AND claimed_at IS NULL`,
+	// 23: время доставки; для уже доставленных посылок остаётся пустым
+	`ALTER TABLE parcel ADD COLUMN delivered_at text`,
+}
+
+// LatestSchemaVersion возвращает версию схемы после применения всех миграций
+func LatestSchemaVersion() int {
+	return baseSchemaVersion + len(migrations)
+}
+
+// Migrate последовательно применяет миграции, пока схема не достигнет версии target.
+// Каждый шаг выполняется в отдельной транзакции и записывается в schema_version,
+// поэтому прерванную миграцию можно продолжить повторным вызовом.
+// Откат к более ранней версии не поддерживается
+func (s ParcelStore) Migrate(target int) error {
+	if target < baseSchemaVersion || target > LatestSchemaVersion() {
+		return fmt.Errorf("unknown schema version %d, latest is %d", target, LatestSchemaVersion())
+	}
+
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current == 0 {
+		return ErrSchemaNotInitialized
+	}
+	if target < current {
+		return fmt.Errorf("cannot migrate schema down from version %d to %d", current, target)
+	}
+
+	for version := current + 1; version <= target; version++ {
+		err := s.applyMigration(version)
+		if err != nil {
+			return fmt.Errorf("migrate schema to version %d: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+// applyMigration применяет шаг миграции, переводящий схему в версию version
+func (s ParcelStore) applyMigration(version int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(migrations[version-baseSchemaVersion-1])
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO schema_version (version, applied_at) VALUES (:version, :applied_at)",
+		sql.Named("version", version),
+		sql.Named("applied_at", time.Now().UTC().Format(time.RFC3339)))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
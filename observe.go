@@ -0,0 +1,27 @@
+package main
+
+import "time"
+
+// SlowQueryFunc получает имя метода хранилища op, время выполнения d и текст запроса
+type SlowQueryFunc func(op string, d time.Duration, query string)
+
+// WithSlowQueryObserver возвращает копию хранилища, которая вызывает fn для запросов,
+// выполнявшихся не меньше threshold; при нулевом threshold fn вызывается для всех запросов.
+// Наблюдаются Get, методы, возвращающие списки посылок, и методы записи. Для записи
+// в транзакции d — время всего метода, а query пуст, так как запросов в ней несколько
+func (s ParcelStore) WithSlowQueryObserver(threshold time.Duration, fn SlowQueryFunc) ParcelStore {
+	s.slowQueryThreshold = threshold
+	s.onSlowQuery = fn
+	return s
+}
+
+// observe передаёт запрос наблюдателю, если он выполнялся не меньше порога.
+// Вызывается через defer, поэтому start вычисляется в момент начала запроса
+func (s ParcelStore) observe(op string, query string, start time.Time) {
+	if s.onSlowQuery == nil {
+		return
+	}
+	if d := time.Since(start); d >= s.slowQueryThreshold {
+		s.onSlowQuery(op, d, query)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSlowQueryObserver проверяет, что наблюдатель получает запросы чтения и записи не быстрее порога
+func TestSlowQueryObserver(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+
+	type call struct {
+		op    string
+		query string
+	}
+	var calls []call
+
+	// при нулевом пороге наблюдатель получает все запросы
+	store := NewParcelStore(db).WithSlowQueryObserver(0,
+		func(op string, d time.Duration, query string) {
+			require.GreaterOrEqual(t, d, time.Duration(0))
+			calls = append(calls, call{op: op, query: query})
+		})
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetAddress(id, "new address"))
+	_, err = store.Get(id)
+	require.NoError(t, err)
+	_, err = store.Where("number = ?", id)
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+
+	other, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(other))
+
+	// check
+	var ops []string
+	for _, c := range calls {
+		ops = append(ops, c.op)
+	}
+	require.Equal(t, []string{"Add", "SetAddress", "Get", "Where", "SetStatus", "Add", "Delete"}, ops)
+	require.Contains(t, calls[3].query, "number = ?")
+	// запись в транзакции состоит из нескольких запросов, поэтому текст не передаётся
+	require.Empty(t, calls[0].query)
+
+	// запросы быстрее порога не передаются
+	calls = nil
+	quiet := NewParcelStore(db).WithSlowQueryObserver(time.Hour,
+		func(op string, d time.Duration, query string) {
+			calls = append(calls, call{op: op, query: query})
+		})
+
+	id, err = quiet.Add(getTestParcel())
+	require.NoError(t, err)
+	_, err = quiet.Get(id)
+	require.NoError(t, err)
+	require.Empty(t, calls)
+
+	// при ненулевом пороге передаётся только медленный запрос
+	slow := NewParcelStore(db).WithSlowQueryObserver(50*time.Millisecond,
+		func(op string, d time.Duration, query string) {
+			require.GreaterOrEqual(t, d, 50*time.Millisecond)
+			calls = append(calls, call{op: op, query: query})
+		})
+
+	_, err = slow.Get(id)
+	require.NoError(t, err)
+	require.Empty(t, calls)
+
+	// рекурсивный CTE заведомо выполняется дольше порога
+	_, err = slow.Where(`number = ? AND (WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000)
+		SELECT COUNT(*) FROM c) > 0`, id)
+	require.NoError(t, err)
+	require.Len(t, calls, 1)
+	require.Equal(t, "Where", calls[0].op)
+	require.Contains(t, calls[0].query, "WITH RECURSIVE")
+}
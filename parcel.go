@@ -2,59 +2,714 @@ package main
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 )
 
+var (
+	// ErrParcelNotFound возвращается, если посылки с заданным номером нет в БД
+	ErrParcelNotFound = errors.New("parcel not found")
+	// ErrBackfillDisabled возвращается при попытке изменить дату создания посылки
+	// в хранилище, для которого не включена загрузка исторических данных
+	ErrBackfillDisabled = errors.New("backfill is not allowed for this store")
+	// ErrStoreClosed возвращается при обращении к хранилищу после закрытия БД
+	ErrStoreClosed = errors.New("parcel store is closed")
+	// ErrWrongStatus возвращается, если операция недопустима в текущем статусе посылки
+	ErrWrongStatus = errors.New("operation is not allowed in the current parcel status")
+	// ErrClientLimitExceeded возвращается, если у клиента уже максимальное количество незавершённых посылок
+	ErrClientLimitExceeded = errors.New("client open parcels limit exceeded")
+	// ErrTooManyRows возвращается вместе с обрезанным результатом, если запрос вернул больше maxRows посылок
+	ErrTooManyRows = errors.New("too many rows")
+	// ErrProbableDuplicate возвращается, если клиент только что зарегистрировал посылку на тот же адрес
+	ErrProbableDuplicate = errors.New("probable duplicate parcel")
+	// ErrParcelImmutable возвращается при попытке изменить адрес, получателя или клиента доставленной посылки.
+	// Массовые операции вместо этого пропускают доставленные посылки
+	ErrParcelImmutable = errors.New("delivered parcel is immutable")
+	// ErrNumberDeleted возвращается, если генератор номеров выдал номер удалённой посылки (см. WasDeleted)
+	ErrNumberDeleted = errors.New("parcel number was deleted")
+)
+
+// errDBClosedText текст ошибки database/sql при обращении к закрытой БД.
+// Сама ошибка в пакете не экспортируется, поэтому сравниваем по тексту
+const errDBClosedText = "sql: database is closed"
+
+// checkClosed оборачивает ошибку обращения к закрытой БД в ErrStoreClosed,
+// остальные ошибки возвращает без изменений
+func checkClosed(err error) error {
+	if err != nil && err.Error() == errDBClosedText {
+		return fmt.Errorf("%w: %w", ErrStoreClosed, err)
+	}
+	return err
+}
+
+// parcelColumns столбцы таблицы parcel в том порядке, в котором их читает scanParcel
+const parcelColumns = "number, client, status, address, created_at, carrier_tracking, recipient"
+
+// parcelColumnsOf возвращает parcelColumns с псевдонимом таблицы alias для запросов с JOIN
+func parcelColumnsOf(alias string) string {
+	columns := strings.Split(parcelColumns, ", ")
+	for i := range columns {
+		columns[i] = alias + "." + columns[i]
+	}
+	return strings.Join(columns, ", ")
+}
+
+// NumberGenerator возвращает номер для новой посылки
+type NumberGenerator func() int
+
 type ParcelStore struct {
 	db *sql.DB
+	// readDB если задан, запросы на чтение выполняются на нём, например на реплике
+	readDB *sql.DB
+	// numberGenerator если задан, номера новых посылок берутся из него, а не из autoincrement
+	numberGenerator NumberGenerator
+	// allowBackfill разрешает менять дату создания уже добавленных посылок
+	allowBackfill bool
+	// maxOpenPerClient максимальное количество посылок клиента в статусах registered и sent,
+	// 0 — без ограничений
+	maxOpenPerClient int
+	// duplicateWindow промежуток, в течение которого посылка того же клиента на тот же адрес
+	// считается повторной отправкой, 0 — проверка отключена
+	duplicateWindow time.Duration
+	// maxRows максимальное количество посылок в результате списочных запросов, 0 — без ограничений
+	maxRows int
+	// sla допустимое время нахождения посылки в статусе, см. SLABreaches
+	sla map[string]time.Duration
+	// slowQueryThreshold и onSlowQuery наблюдатель медленных запросов, см. WithSlowQueryObserver
+	slowQueryThreshold time.Duration
+	onSlowQuery        SlowQueryFunc
+	// recordHistory включает запись изменений статусов в историю, см. WithHistory
+	recordHistory bool
+	// afterStatusRead если задан, вызывается в SetStatus между чтением текущего статуса
+	// и его изменением. Задаётся только в тестах, чтобы воспроизвести одновременное изменение
+	afterStatusRead func()
 }
 
 func NewParcelStore(db *sql.DB) ParcelStore {
 	return ParcelStore{db: db}
 }
 
+// WithReadDB возвращает копию хранилища, которая выполняет запросы на чтение на readDB,
+// например на реплике, а изменения — на основной БД. Чтение внутри изменяющих
+// транзакций по-прежнему идёт в основную БД
+func (s ParcelStore) WithReadDB(readDB *sql.DB) ParcelStore {
+	s.readDB = readDB
+	return s
+}
+
+// reader возвращает БД для запросов на чтение
+func (s ParcelStore) reader() *sql.DB {
+	if s.readDB != nil {
+		return s.readDB
+	}
+	return s.db
+}
+
+// WithNumberGenerator возвращает копию хранилища, которая присваивает номера новым посылкам
+// с помощью gen вместо autoincrement. Используется в тестах, где нужны предсказуемые номера
+func (s ParcelStore) WithNumberGenerator(gen NumberGenerator) ParcelStore {
+	s.numberGenerator = gen
+	return s
+}
+
+// WithBackfill возвращает копию хранилища, в которой разрешён SetCreatedAt.
+// Предназначено только для миграций исторических данных
+func (s ParcelStore) WithBackfill() ParcelStore {
+	s.allowBackfill = true
+	return s
+}
+
+// WithMaxOpenPerClient возвращает копию хранилища, которая не даёт добавить клиенту
+// больше n незавершённых (registered или sent) посылок
+func (s ParcelStore) WithMaxOpenPerClient(n int) ParcelStore {
+	s.maxOpenPerClient = n
+	return s
+}
+
+// WithDuplicateWindow возвращает копию хранилища, которая отклоняет посылку, если тот же клиент
+// зарегистрировал посылку на тот же адрес менее window назад. Защищает от случайной повторной отправки формы
+func (s ParcelStore) WithDuplicateWindow(window time.Duration) ParcelStore {
+	s.duplicateWindow = window
+	return s
+}
+
+// WithMaxRows возвращает копию хранилища, списочные запросы которой возвращают не больше n посылок.
+// Если посылок больше, возвращаются первые n и ошибка ErrTooManyRows
+func (s ParcelStore) WithMaxRows(n int) ParcelStore {
+	s.maxRows = n
+	return s
+}
+
 func (s ParcelStore) Add(p Parcel) (int, error) {
-	// реализуйте добавление строки в таблицу parcel, используйте данные из переменной p
+	defer s.observe("Add", "", time.Now())
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	id, err := s.insertParcel(tx, p)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// AddReturning добавляет посылку и возвращает её в том виде, в котором она сохранена в БД,
+// с присвоенным номером и значениями по умолчанию
+func (s ParcelStore) AddReturning(p Parcel) (Parcel, error) {
+	defer s.observe("AddReturning", "", time.Now())
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Parcel{}, checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	id, err := s.insertParcel(tx, p)
+	if err != nil {
+		return Parcel{}, err
+	}
+
+	row := tx.QueryRow("SELECT "+parcelColumns+" FROM parcel WHERE number = :number",
+		sql.Named("number", id))
+	stored, err := scanParcel(row)
+	if err != nil {
+		return Parcel{}, err
+	}
+
+	return stored, tx.Commit()
+}
+
+// insertParcel добавляет посылку в рамках транзакции tx и возвращает её номер
+func (s ParcelStore) insertParcel(tx *sql.Tx, p Parcel) (int, error) {
+	err := s.checkOpenLimit(tx, p)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.checkDuplicate(tx, p)
+	if err != nil {
+		return 0, err
+	}
 
-	// верните идентификатор последней добавленной записи
-	return 0, nil
+	// при number = NULL SQLite сам присваивает номер через autoincrement
+	var number sql.NullInt64
+	if s.numberGenerator != nil {
+		number = sql.NullInt64{Int64: int64(s.numberGenerator()), Valid: true}
+
+		// autoincrement не выдаёт номера повторно, а внешний генератор может
+		var deleted bool
+		err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM parcel_tombstones WHERE number = :number)",
+			sql.Named("number", number)).Scan(&deleted)
+		if err != nil {
+			return 0, err
+		}
+		if deleted {
+			return 0, fmt.Errorf("%w: %d", ErrNumberDeleted, number.Int64)
+		}
+	}
+
+	res, err := tx.Exec("INSERT INTO parcel (number, client, status, address, created_at, recipient) VALUES (:number, :client, :status, :address, :created_at, :recipient)",
+		sql.Named("number", number),
+		sql.Named("client", p.Client),
+		sql.Named("status", p.Status),
+		sql.Named("address", p.Address),
+		sql.Named("created_at", p.CreatedAt),
+		sql.Named("recipient", p.Recipient))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	// первая запись в истории — статус, с которым посылка зарегистрирована
+	err = s.recordStatus(tx, int(id), p.Status, p.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// checkOpenLimit проверяет, не превысит ли добавление посылки p лимит незавершённых посылок клиента
+func (s ParcelStore) checkOpenLimit(tx *sql.Tx, p Parcel) error {
+	if s.maxOpenPerClient <= 0 || p.Status == ParcelStatusDelivered {
+		return nil
+	}
+
+	var open int
+	err := tx.QueryRow("SELECT COUNT(*) FROM parcel WHERE client = :client AND status IN (:registered, :sent)",
+		sql.Named("client", p.Client),
+		sql.Named("registered", ParcelStatusRegistered),
+		sql.Named("sent", ParcelStatusSent)).Scan(&open)
+	if err != nil {
+		return err
+	}
+
+	if open >= s.maxOpenPerClient {
+		return fmt.Errorf("%w: client %d has %d open parcels", ErrClientLimitExceeded, p.Client, open)
+	}
+
+	return nil
+}
+
+// checkDuplicate проверяет, не регистрировал ли клиент посылку на тот же адрес в пределах duplicateWindow
+func (s ParcelStore) checkDuplicate(tx *sql.Tx, p Parcel) error {
+	if s.duplicateWindow <= 0 {
+		return nil
+	}
+
+	since := time.Now().Add(-s.duplicateWindow).UTC().Format(time.RFC3339)
+
+	var number int
+	err := tx.QueryRow("SELECT number FROM parcel WHERE client = :client AND address = :address AND created_at >= :since LIMIT 1",
+		sql.Named("client", p.Client),
+		sql.Named("address", p.Address),
+		sql.Named("since", since)).Scan(&number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: parcel %d has the same client and address", ErrProbableDuplicate, number)
 }
 
 func (s ParcelStore) Get(number int) (Parcel, error) {
-	// реализуйте чтение строки по заданному number
-	// здесь из таблицы должна вернуться только одна строка
+	query := "SELECT " + parcelColumns + " FROM parcel WHERE number = :number"
+	defer s.observe("Get", query, time.Now())
 
-	// заполните объект Parcel данными из таблицы
-	p := Parcel{}
+	row := s.reader().QueryRow(query, sql.Named("number", number))
+	p, err := scanParcel(row)
+	if err != nil {
+		return p, checkClosed(err)
+	}
 
 	return p, nil
 }
 
 func (s ParcelStore) GetByClient(client int) ([]Parcel, error) {
-	// реализуйте чтение строк из таблицы parcel по заданному client
-	// здесь из таблицы может вернуться несколько строк
+	return s.queryParcels("GetByClient", "SELECT "+parcelColumns+" FROM parcel WHERE client = :client ORDER BY number",
+		sql.Named("client", client))
+}
+
+// GetByClientInto работает как GetByClient, но записывает посылки в *dst, переиспользуя
+// его ёмкость: длина *dst сбрасывается в 0, новый массив выделяется только при нехватке места.
+// Позволяет не выделять память заново при многократных вызовах в цикле
+func (s ParcelStore) GetByClientInto(client int, dst *[]Parcel) error {
+	res, err := s.queryParcelsInto("GetByClientInto", (*dst)[:0],
+		"SELECT "+parcelColumns+" FROM parcel WHERE client = :client ORDER BY number",
+		sql.Named("client", client))
+	if res == nil {
+		// при ошибке сохраняем ёмкость *dst для следующих вызовов
+		res = (*dst)[:0]
+	}
+	*dst = res
+	return err
+}
+
+// GetByClientAndNumbers возвращает посылки клиента client с номерами из numbers,
+// упорядоченные по номеру. Номера чужих посылок пропускаются, поэтому клиент не может
+// выбрать посылку другого клиента. Для пустого numbers возвращается пустой результат
+func (s ParcelStore) GetByClientAndNumbers(client int, numbers []int) ([]Parcel, error) {
+	if len(numbers) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, len(numbers))
+	args := make([]any, 0, len(numbers)+1)
+	for i, number := range numbers {
+		name := fmt.Sprintf("n%d", i)
+		placeholders[i] = ":" + name
+		args = append(args, sql.Named(name, number))
+	}
+	args = append(args, sql.Named("client", client))
+
+	return s.queryParcels("GetByClientAndNumbers", "SELECT "+parcelColumns+
+		" FROM parcel WHERE client = :client AND number IN ("+strings.Join(placeholders, ", ")+") ORDER BY number",
+		args...)
+}
+
+// queryParcels выполняет запрос, возвращающий посылки со столбцами parcelColumns.
+// op — имя вызывающего метода для наблюдателя медленных запросов.
+// Если задан maxRows, к запросу добавляется LIMIT, поэтому query не должен
+// заканчиваться собственным LIMIT
+func (s ParcelStore) queryParcels(op string, query string, args ...any) ([]Parcel, error) {
+	return s.queryParcelsInto(op, nil, query, args...)
+}
+
+// queryParcelsInto работает как queryParcels, но добавляет посылки в dst
+func (s ParcelStore) queryParcelsInto(op string, dst []Parcel, query string, args ...any) ([]Parcel, error) {
+	if s.maxRows > 0 {
+		// лишняя строка нужна, чтобы отличить ровно maxRows посылок от обрезанного результата
+		query += fmt.Sprintf(" LIMIT %d", s.maxRows+1)
+	}
+	defer s.observe(op, query, time.Now())
+
+	rows, err := s.reader().Query(query, args...)
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	res, err := scanParcelsInto(rows, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.maxRows > 0 && len(res)-len(dst) > s.maxRows {
+		return res[:len(dst)+s.maxRows], fmt.Errorf("%w: result is limited to %d parcels", ErrTooManyRows, s.maxRows)
+	}
+
+	return res, nil
+}
+
+// scanner общий интерфейс *sql.Row и *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
 
-	// заполните срез Parcel данными из таблицы
-	var res []Parcel
+// scanParcel читает посылку из строки, выбранной со столбцами parcelColumns
+func scanParcel(row scanner) (Parcel, error) {
+	p := Parcel{}
+	err := row.Scan(&p.Number, &p.Client, &p.Status, &p.Address, &p.CreatedAt, &p.CarrierTracking, &p.Recipient)
+	return p, err
+}
+
+// scanParcels читает все посылки из rows, выбранных со столбцами parcelColumns
+func scanParcels(rows *sql.Rows) ([]Parcel, error) {
+	return scanParcelsInto(rows, nil)
+}
+
+// scanParcelsInto добавляет все посылки из rows в dst
+func scanParcelsInto(rows *sql.Rows, dst []Parcel) ([]Parcel, error) {
+	res := dst
+	for rows.Next() {
+		p, err := scanParcel(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return res, nil
 }
 
+// SetStatus переводит посылку в статус status.
+// Допускаются только переходы вперёд: registered -> sent -> delivered
 func (s ParcelStore) SetStatus(number int, status string) error {
-	// реализуйте обновление статуса в таблице parcel
+	defer s.observe("SetStatus", "", time.Now())
 
-	return nil
+	tx, err := s.db.Begin()
+	if err != nil {
+		return checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	current, err := getStatus(tx, number)
+	if err != nil {
+		return err
+	}
+
+	err = checkTransition(current, status)
+	if err != nil {
+		return err
+	}
+
+	if s.afterStatusRead != nil {
+		s.afterStatusRead()
+	}
+
+	err = s.changeStatus(tx, number, current, status, "")
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (s ParcelStore) SetAddress(number int, address string) error {
-	// реализуйте обновление адреса в таблице parcel
+	defer s.observe("SetAddress", "", time.Now())
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	err = checkMutable(tx, number)
+	if errors.Is(err, ErrParcelNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
 	// менять адрес можно только если значение статуса registered
+	_, err = tx.Exec("UPDATE parcel SET address = :address, updated_at = :updated_at WHERE number = :number AND status = :status",
+		sql.Named("address", address),
+		sql.Named("updated_at", time.Now().UTC().Format(time.RFC3339)),
+		sql.Named("number", number),
+		sql.Named("status", ParcelStatusRegistered))
+	if err != nil {
+		return err
+	}
 
-	return nil
+	return tx.Commit()
 }
 
 func (s ParcelStore) Delete(number int) error {
-	// реализуйте удаление строки из таблицы parcel
+	defer s.observe("Delete", "", time.Now())
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return checkClosed(err)
+	}
+	defer tx.Rollback()
+
 	// удалять строку можно только если значение статуса registered
+	res, err := tx.Exec("DELETE FROM parcel WHERE number = :number AND status = :status",
+		sql.Named("number", number),
+		sql.Named("status", ParcelStatusRegistered))
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+
+	// вместе с посылкой удаляем её историю статусов, метки и историю смены клиента
+	_, err = tx.Exec("DELETE FROM status_history WHERE number = :number",
+		sql.Named("number", number))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM parcel_labels WHERE number = :number",
+		sql.Named("number", number))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM client_history WHERE number = :number",
+		sql.Named("number", number))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO parcel_tombstones (number, deleted_at) VALUES (:number, :deleted_at)",
+		sql.Named("number", number),
+		sql.Named("deleted_at", time.Now().UTC().Format(time.RFC3339)))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// WasDeleted сообщает, была ли посылка с номером number удалена через Delete или DeleteByStatus
+func (s ParcelStore) WasDeleted(number int) (bool, error) {
+	var deleted bool
+
+	err := s.reader().QueryRow("SELECT EXISTS (SELECT 1 FROM parcel_tombstones WHERE number = :number)",
+		sql.Named("number", number)).Scan(&deleted)
+	if err != nil {
+		return false, checkClosed(err)
+	}
+
+	return deleted, nil
+}
+
+// SetCreatedAt меняет дату создания посылки. Нужен для загрузки исторических данных
+// и работает только в хранилище, полученном через WithBackfill
+func (s ParcelStore) SetCreatedAt(number int, t time.Time) error {
+	if !s.allowBackfill {
+		return ErrBackfillDisabled
+	}
+
+	query := "UPDATE parcel SET created_at = :created_at WHERE number = :number"
+	defer s.observe("SetCreatedAt", query, time.Now())
+
+	res, err := s.db.Exec(query,
+		sql.Named("created_at", t.UTC().Format(time.RFC3339)),
+		sql.Named("number", number))
+	if err != nil {
+		return checkClosed(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrParcelNotFound
+	}
 
 	return nil
 }
+
+// Duplicate создаёт новую посылку в статусе registered с теми же клиентом, адресом и получателем,
+// что у посылки number, и возвращает номер новой посылки
+func (s ParcelStore) Duplicate(number int) (int, error) {
+	defer s.observe("Duplicate", "", time.Now())
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	p := Parcel{}
+
+	err = tx.QueryRow("SELECT client, address, recipient FROM parcel WHERE number = :number",
+		sql.Named("number", number)).Scan(&p.Client, &p.Address, &p.Recipient)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrParcelNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	p.Status = ParcelStatusRegistered
+	p.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	id, err := s.insertParcel(tx, p)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// ParcelAge возвращает время, прошедшее с регистрации посылки
+func (s ParcelStore) ParcelAge(number int) (time.Duration, error) {
+	p, err := s.Get(number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrParcelNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, p.CreatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("parcel %d: parse created_at: %w", number, err)
+	}
+
+	return time.Since(createdAt), nil
+}
+
+// DeleteByStatus удаляет все посылки в статусе status вместе с их историями и метками,
+// запоминает их номера (см. WasDeleted) и возвращает количество удалённых посылок. Предназначен для обслуживания БД,
+// поэтому, в отличие от Delete, удаляет посылки в любом статусе
+func (s ParcelStore) DeleteByStatus(status string) (int64, error) {
+	defer s.observe("DeleteByStatus", "", time.Now())
+
+	if !validStatus(status) {
+		return 0, fmt.Errorf("%w %q", ErrUnknownStatus, status)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"status_history", "parcel_labels", "client_history"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE number IN (SELECT number FROM parcel WHERE status = :status)",
+			sql.Named("status", status))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO parcel_tombstones (number, deleted_at) SELECT number, :deleted_at FROM parcel WHERE status = :status",
+		sql.Named("deleted_at", time.Now().UTC().Format(time.RFC3339)),
+		sql.Named("status", status))
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec("DELETE FROM parcel WHERE status = :status",
+		sql.Named("status", status))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return n, tx.Commit()
+}
+
+// DeleteByStatusPreview возвращает посылки, которые удалил бы DeleteByStatus(status),
+// ничего не удаляя
+func (s ParcelStore) DeleteByStatusPreview(status string) ([]Parcel, error) {
+	if !validStatus(status) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownStatus, status)
+	}
+
+	return s.Query().Status(status).All()
+}
+
+// DeletePreview сообщает, удалил бы Delete посылку number, ничего не удаляя:
+// удалить можно только существующую посылку в статусе registered
+func (s ParcelStore) DeletePreview(number int) (bool, error) {
+	n, err := s.Query().where("number = ?", number).Status(ParcelStatusRegistered).Count()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// Neighbors возвращает посылки с ближайшими к number меньшим и большим номерами.
+// Если соседа нет, вместо него возвращается пустая посылка с Number == 0.
+// Сама посылка number может и не существовать
+func (s ParcelStore) Neighbors(number int) (prev, next Parcel, err error) {
+	prev, err = s.neighbor("SELECT "+parcelColumns+" FROM parcel WHERE number < :number ORDER BY number DESC LIMIT 1", number)
+	if err != nil {
+		return Parcel{}, Parcel{}, err
+	}
+
+	next, err = s.neighbor("SELECT "+parcelColumns+" FROM parcel WHERE number > :number ORDER BY number LIMIT 1", number)
+	if err != nil {
+		return Parcel{}, Parcel{}, err
+	}
+
+	return prev, next, nil
+}
+
+// neighbor выполняет запрос соседней посылки, отсутствие соседа не считается ошибкой
+func (s ParcelStore) neighbor(query string, number int) (Parcel, error) {
+	p, err := scanParcel(s.reader().QueryRow(query, sql.Named("number", number)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Parcel{}, nil
+	}
+	if err != nil {
+		return Parcel{}, checkClosed(err)
+	}
+
+	return p, nil
+}
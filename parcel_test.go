@@ -3,6 +3,9 @@ package main
 import (
 	"database/sql"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -18,6 +21,44 @@ var (
 	randRange = rand.New(randSource)
 )
 
+// TestMain перед запуском тестов создаёт в tracker.db недостающие таблицы
+// и применяет миграции
+func TestMain(m *testing.M) {
+	db, err := sql.Open("sqlite", "tracker.db")
+	if err != nil {
+		panic(err)
+	}
+
+	store := NewParcelStore(db)
+	err = store.EnsureSchema()
+	if err == nil {
+		err = store.Migrate(LatestSchemaVersion())
+	}
+	db.Close()
+	if err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// openTestDB открывает пустую БД во временном каталоге теста.
+// Используется там, где результат зависит от всего содержимого таблицы.
+// busy_timeout нужен тестам, которые пишут в БД из нескольких горутин
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tracker.db")+"?_pragma=busy_timeout(5000)")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	store := NewParcelStore(db)
+	err = store.EnsureSchema()
+	require.NoError(t, err)
+	err = store.Migrate(LatestSchemaVersion())
+	require.NoError(t, err)
+
+	return db
+}
+
 // getTestParcel возвращает тестовую посылку
 func getTestParcel() Parcel {
 	return Parcel{
@@ -31,57 +72,170 @@ func getTestParcel() Parcel {
 // TestAddGetDelete проверяет добавление, получение и удаление посылки
 func TestAddGetDelete(t *testing.T) {
 	// prepare
-	db, err := // настройте подключение к БД
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
 	store := NewParcelStore(db)
 	parcel := getTestParcel()
 
 	// add
-	// добавьте новую посылку в БД, убедитесь в отсутствии ошибки и наличии идентификатора
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+	parcel.Number = id
 
 	// get
-	// получите только что добавленную посылку, убедитесь в отсутствии ошибки
-	// проверьте, что значения всех полей в полученном объекте совпадают со значениями полей в переменной parcel
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, parcel, stored)
 
 	// delete
-	// удалите добавленную посылку, убедитесь в отсутствии ошибки
-	// проверьте, что посылку больше нельзя получить из БД
+	err = store.Delete(id)
+	require.NoError(t, err)
+
+	_, err = store.Get(id)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+// TestAddReturning проверяет, что добавленная посылка возвращается в сохранённом виде
+func TestAddReturning(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+	parcel := getTestParcel()
+
+	// add
+	added, err := store.AddReturning(parcel)
+	require.NoError(t, err)
+	require.NotEmpty(t, added.Number)
+
+	parcel.Number = added.Number
+	require.Equal(t, parcel, added)
+
+	// get
+	stored, err := store.Get(added.Number)
+	require.NoError(t, err)
+	require.Equal(t, stored, added)
+
+	err = store.Delete(added.Number)
+	require.NoError(t, err)
+}
+
+// TestWasDeleted проверяет, что номера удалённых посылок запоминаются
+func TestWasDeleted(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	numbers, err := store.SeedParcels(1000, 3, "Unit %d")
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(numbers[1], ParcelStatusSent))
+	require.NoError(t, store.SetStatus(numbers[2], ParcelStatusSent))
+
+	// delete
+	require.NoError(t, store.Delete(numbers[0]))
+	deleted, err := store.DeleteByStatus(ParcelStatusSent)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, deleted)
+
+	// check
+	for _, number := range numbers {
+		ok, err := store.WasDeleted(number)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	ok, err := store.WasDeleted(numbers[2] + 1)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+// TestDeletedNumberNotReused проверяет, что номер удалённой посылки нельзя выдать повторно
+func TestDeletedNumberNotReused(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	number := 5000
+	manual := store.WithNumberGenerator(func() int { return number })
+
+	id, err := manual.Add(getTestParcel())
+	require.NoError(t, err)
+	require.Equal(t, number, id)
+	require.NoError(t, store.Delete(id))
+
+	// add
+	_, err = manual.Add(getTestParcel())
+	require.ErrorIs(t, err, ErrNumberDeleted)
+
+	_, err = store.Get(number)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	number++
+	id, err = manual.Add(getTestParcel())
+	require.NoError(t, err)
+	require.Equal(t, number, id)
 }
 
 // TestSetAddress проверяет обновление адреса
 func TestSetAddress(t *testing.T) {
 	// prepare
-	db, err := // настройте подключение к БД
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
 
 	// add
-	// добавьте новую посылку в БД, убедитесь в отсутствии ошибки и наличии идентификатора
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
 
 	// set address
-	// обновите адрес, убедитесь в отсутствии ошибки
 	newAddress := "new test address"
+	err = store.SetAddress(id, newAddress)
+	require.NoError(t, err)
 
 	// check
-	// получите добавленную посылку и убедитесь, что адрес обновился
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, newAddress, stored.Address)
 }
 
 // TestSetStatus проверяет обновление статуса
 func TestSetStatus(t *testing.T) {
 	// prepare
-	db, err := // настройте подключение к БД
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
 
 	// add
-	// добавьте новую посылку в БД, убедитесь в отсутствии ошибки и наличии идентификатора
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
 
 	// set status
-	// обновите статус, убедитесь в отсутствии ошибки
+	err = store.SetStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
 
 	// check
-	// получите добавленную посылку и убедитесь, что статус обновился
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, stored.Status)
 }
 
 // TestGetByClient проверяет получение посылок по идентификатору клиента
 func TestGetByClient(t *testing.T) {
 	// prepare
-	db, err := // настройте подключение к БД
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
 
 	parcels := []Parcel{
 		getTestParcel(),
@@ -98,7 +252,9 @@ func TestGetByClient(t *testing.T) {
 
 	// add
 	for i := 0; i < len(parcels); i++ {
-		id, err := // добавьте новую посылку в БД, убедитесь в отсутствии ошибки и наличии идентификатора
+		id, err := store.Add(parcels[i])
+		require.NoError(t, err)
+		require.NotEmpty(t, id)
 
 		// обновляем идентификатор добавленной у посылки
 		parcels[i].Number = id
@@ -108,14 +264,554 @@ func TestGetByClient(t *testing.T) {
 	}
 
 	// get by client
-	storedParcels, err := // получите список посылок по идентификатору клиента, сохранённого в переменной client
-	// убедитесь в отсутствии ошибки
-	// убедитесь, что количество полученных посылок совпадает с количеством добавленных
+	storedParcels, err := store.GetByClient(client)
+	require.NoError(t, err)
+	require.Len(t, storedParcels, len(parcels))
 
 	// check
 	for _, parcel := range storedParcels {
-		// в parcelMap лежат добавленные посылки, ключ - идентификатор посылки, значение - сама посылка
-		// убедитесь, что все посылки из storedParcels есть в parcelMap
-		// убедитесь, что значения полей полученных посылок заполнены верно
+		expected, ok := parcelMap[parcel.Number]
+		require.True(t, ok)
+		require.Equal(t, expected, parcel)
+	}
+}
+
+// TestGetByClientInto проверяет чтение посылок клиента в переиспользуемый срез
+func TestGetByClientInto(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	numbers, err := store.SeedParcels(1000, 3, "Unit %d")
+	require.NoError(t, err)
+
+	// в срезе остались посылки от предыдущего вызова и есть запас ёмкости
+	dst := make([]Parcel, 5, 10)
+	for i := range dst {
+		dst[i] = Parcel{Number: -i}
+	}
+	capacity := cap(dst)
+
+	// get
+	err = store.GetByClientInto(1000, &dst)
+	require.NoError(t, err)
+	require.Len(t, dst, 3)
+	require.Equal(t, capacity, cap(dst))
+	for i, p := range dst {
+		require.Equal(t, numbers[i], p.Number)
+	}
+
+	expected, err := store.GetByClient(1000)
+	require.NoError(t, err)
+	require.Equal(t, expected, dst)
+
+	err = store.GetByClientInto(2000, &dst)
+	require.NoError(t, err)
+	require.Empty(t, dst)
+	require.Equal(t, capacity, cap(dst))
+}
+
+// TestGetByClientAndNumbers проверяет, что посылки других клиентов не попадают в выборку
+func TestGetByClientAndNumbers(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	own, err := store.SeedParcels(1000, 3, "Own %d")
+	require.NoError(t, err)
+	foreign, err := store.SeedParcels(2000, 2, "Foreign %d")
+	require.NoError(t, err)
+
+	// get
+	parcels, err := store.GetByClientAndNumbers(1000, []int{foreign[0], own[2], own[0], foreign[1], 1_000_000})
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	require.Equal(t, own[0], parcels[0].Number)
+	require.Equal(t, own[2], parcels[1].Number)
+
+	parcels, err = store.GetByClientAndNumbers(2000, own)
+	require.NoError(t, err)
+	require.Empty(t, parcels)
+
+	parcels, err = store.GetByClientAndNumbers(1000, nil)
+	require.NoError(t, err)
+	require.Empty(t, parcels)
+}
+
+// BenchmarkGetByClient сравнивает GetByClient и GetByClientInto
+func BenchmarkGetByClient(b *testing.B) {
+	db, err := sql.Open("sqlite", filepath.Join(b.TempDir(), "tracker.db"))
+	require.NoError(b, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+	require.NoError(b, store.EnsureSchema())
+	require.NoError(b, store.Migrate(LatestSchemaVersion()))
+
+	_, err = store.SeedParcels(1000, 100, "Unit %d")
+	require.NoError(b, err)
+
+	b.Run("GetByClient", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, err := store.GetByClient(1000)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("GetByClientInto", func(b *testing.B) {
+		b.ReportAllocs()
+		var dst []Parcel
+		for i := 0; i < b.N; i++ {
+			err := store.GetByClientInto(1000, &dst)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestNumberGenerator проверяет присвоение номеров посылкам через NumberGenerator
+func TestNumberGenerator(t *testing.T) {
+	// prepare
+	next := 1000
+	gen := func() int {
+		next++
+		return next
+	}
+	store := NewParcelStore(openTestDB(t)).WithNumberGenerator(gen)
+
+	// add
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.Equal(t, 1001, id)
+
+	id, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.Equal(t, 1002, id)
+
+	// check
+	stored, err := store.Get(1002)
+	require.NoError(t, err)
+	require.Equal(t, 1002, stored.Number)
+}
+
+// TestSetCreatedAt проверяет изменение даты создания посылки при загрузке исторических данных
+func TestSetCreatedAt(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+
+	// add
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+
+	// set created at
+	createdAt := time.Date(2019, time.March, 8, 10, 30, 0, 0, time.UTC)
+	err = store.SetCreatedAt(id, createdAt)
+	require.ErrorIs(t, err, ErrBackfillDisabled)
+
+	err = store.WithBackfill().SetCreatedAt(id, createdAt)
+	require.NoError(t, err)
+
+	// check
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, "2019-03-08T10:30:00Z", stored.CreatedAt)
+}
+
+// TestStoreClosed проверяет ошибку обращения к хранилищу после закрытия БД
+func TestStoreClosed(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	err = db.Close()
+	require.NoError(t, err)
+
+	// get
+	_, err = store.Get(id)
+	require.ErrorIs(t, err, ErrStoreClosed)
+
+	// add
+	_, err = store.Add(getTestParcel())
+	require.ErrorIs(t, err, ErrStoreClosed)
+
+	// get by client
+	_, err = store.GetByClient(1000)
+	require.ErrorIs(t, err, ErrStoreClosed)
+}
+
+// TestDuplicate проверяет создание копии посылки
+func TestDuplicate(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+	parcel := getTestParcel()
+	parcel.Address = "duplicate test address"
+
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	err = store.SetStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
+
+	// duplicate
+	copyID, err := store.Duplicate(id)
+	require.NoError(t, err)
+	require.NotEqual(t, id, copyID)
+
+	// check
+	stored, err := store.Get(copyID)
+	require.NoError(t, err)
+	require.Equal(t, parcel.Client, stored.Client)
+	require.Equal(t, parcel.Address, stored.Address)
+	require.Equal(t, ParcelStatusRegistered, stored.Status)
+
+	_, err = store.Duplicate(-1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestParcelAge проверяет вычисление возраста посылки
+func TestParcelAge(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+	parcel := getTestParcel()
+	parcel.CreatedAt = time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	// age
+	age, err := store.ParcelAge(id)
+	require.NoError(t, err)
+	require.InDelta(t, 48*time.Hour, age, float64(time.Minute))
+
+	_, err = store.ParcelAge(-1)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestMaxOpenPerClient проверяет ограничение количества незавершённых посылок клиента
+func TestMaxOpenPerClient(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db).WithMaxOpenPerClient(2)
+	parcel := getTestParcel()
+	parcel.Client = randRange.Intn(10_000_000) + 1
+
+	// add
+	first, err := store.Add(parcel)
+	require.NoError(t, err)
+	_, err = store.Add(parcel)
+	require.NoError(t, err)
+
+	_, err = store.Add(parcel)
+	require.ErrorIs(t, err, ErrClientLimitExceeded)
+
+	// после доставки посылка перестаёт учитываться в лимите
+	err = store.SetStatus(first, ParcelStatusSent)
+	require.NoError(t, err)
+	err = store.SetStatus(first, ParcelStatusDelivered)
+	require.NoError(t, err)
+
+	_, err = store.Add(parcel)
+	require.NoError(t, err)
+}
+
+// TestDuplicateWindow проверяет отклонение повторной отправки той же посылки
+func TestDuplicateWindow(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db).WithDuplicateWindow(time.Minute)
+	parcel := getTestParcel()
+	parcel.Client = randRange.Intn(10_000_000) + 1
+
+	// add
+	_, err = store.Add(parcel)
+	require.NoError(t, err)
+
+	_, err = store.Add(parcel)
+	require.ErrorIs(t, err, ErrProbableDuplicate)
+
+	// на другой адрес посылку добавить можно
+	parcel.Address = "another test address"
+	_, err = store.Add(parcel)
+	require.NoError(t, err)
+}
+
+// TestDeleteByStatus проверяет удаление всех посылок в заданном статусе
+func TestDeleteByStatus(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	counts := map[string]int{
+		ParcelStatusRegistered: 2,
+		ParcelStatusSent:       1,
+		ParcelStatusDelivered:  3,
 	}
+	for status, n := range counts {
+		for i := 0; i < n; i++ {
+			parcel := getTestParcel()
+			parcel.Status = status
+
+			_, err := store.Add(parcel)
+			require.NoError(t, err)
+		}
+	}
+
+	// delete
+	_, err := store.DeleteByStatus("lost")
+	require.ErrorIs(t, err, ErrUnknownStatus)
+
+	deleted, err := store.DeleteByStatus(ParcelStatusDelivered)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, deleted)
+
+	// check
+	for status, n := range counts {
+		if status == ParcelStatusDelivered {
+			n = 0
+		}
+
+		count, err := store.Query().Status(status).Count()
+		require.NoError(t, err)
+		require.Equal(t, n, count)
+	}
+}
+
+// TestDeletePreview проверяет, что предпросмотр удаления совпадает с удалением и ничего не удаляет
+func TestDeletePreview(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	numbers, err := store.SeedParcels(1000, 4, "Unit %d")
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(numbers[1], ParcelStatusSent))
+	require.NoError(t, store.SetStatus(numbers[3], ParcelStatusSent))
+
+	// preview
+	preview, err := store.DeleteByStatusPreview(ParcelStatusSent)
+	require.NoError(t, err)
+	require.Len(t, preview, 2)
+
+	ok, err := store.DeletePreview(numbers[0])
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = store.DeletePreview(numbers[1])
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, err = store.DeleteByStatusPreview("lost")
+	require.ErrorIs(t, err, ErrUnknownStatus)
+
+	count, err := store.Query().Count()
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+
+	// delete
+	deleted, err := store.DeleteByStatus(ParcelStatusSent)
+	require.NoError(t, err)
+	require.EqualValues(t, len(preview), deleted)
+
+	for _, p := range preview {
+		_, err := store.Get(p.Number)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+	}
+
+	count, err = store.Query().Count()
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
+
+// TestMaxRows проверяет ограничение количества посылок в списочных запросах
+func TestMaxRows(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	var numbers []int
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// truncated
+	parcels, err := store.WithMaxRows(2).GetByClient(1000)
+	require.ErrorIs(t, err, ErrTooManyRows)
+	require.Len(t, parcels, 2)
+	require.Equal(t, numbers[0], parcels[0].Number)
+	require.Equal(t, numbers[1], parcels[1].Number)
+
+	parcels, err = store.WithMaxRows(2).Query().All()
+	require.ErrorIs(t, err, ErrTooManyRows)
+	require.Len(t, parcels, 2)
+
+	// ограничение считает посылки, а не строки с метками
+	for _, label := range []string{"fragile", "heavy", "urgent"} {
+		require.NoError(t, store.AddLabel(numbers[0], label))
+	}
+	withLabels, err := store.WithMaxRows(2).GetWithLabels(1000)
+	require.ErrorIs(t, err, ErrTooManyRows)
+	require.Len(t, withLabels, 2)
+	require.Len(t, withLabels[0].Labels, 3)
+	require.Equal(t, numbers[1], withLabels[1].Number)
+
+	withLabels, err = store.WithMaxRows(3).GetWithLabels(1000)
+	require.NoError(t, err)
+	require.Len(t, withLabels, 3)
+
+	// within limit
+	parcels, err = store.WithMaxRows(3).GetByClient(1000)
+	require.NoError(t, err)
+	require.Len(t, parcels, 3)
+
+	parcels, err = store.GetByClient(1000)
+	require.NoError(t, err)
+	require.Len(t, parcels, 3)
+}
+
+// TestNeighbors проверяет получение соседних по номеру посылок
+func TestNeighbors(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	var numbers []int
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// middle
+	prev, next, err := store.Neighbors(numbers[1])
+	require.NoError(t, err)
+	require.Equal(t, numbers[0], prev.Number)
+	require.Equal(t, numbers[2], next.Number)
+
+	// edges
+	prev, next, err = store.Neighbors(numbers[0])
+	require.NoError(t, err)
+	require.Zero(t, prev.Number)
+	require.Equal(t, numbers[1], next.Number)
+
+	prev, next, err = store.Neighbors(numbers[2])
+	require.NoError(t, err)
+	require.Equal(t, numbers[1], prev.Number)
+	require.Zero(t, next.Number)
+}
+
+// TestWithReadDB проверяет, что чтение идёт из БД для чтения, а запись — в основную БД
+func TestWithReadDB(t *testing.T) {
+	primary := openTestDB(t)
+	replica := openTestDB(t)
+
+	// посылка есть только в реплике
+	replicaNumber, err := NewParcelStore(replica).Add(getTestParcel())
+	require.NoError(t, err)
+
+	store := NewParcelStore(primary).WithReadDB(replica)
+
+	got, err := store.Get(replicaNumber)
+	require.NoError(t, err)
+	require.Equal(t, replicaNumber, got.Number)
+
+	parcels, err := store.GetByClient(got.Client)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+
+	// запись идёт в основную БД
+	parcel := getTestParcel()
+	parcel.Client = 2000
+	number, err := store.Add(parcel)
+	require.NoError(t, err)
+
+	_, err = NewParcelStore(primary).Get(number)
+	require.NoError(t, err)
+
+	parcels, err = store.GetByClient(parcel.Client)
+	require.NoError(t, err)
+	require.Empty(t, parcels)
+
+	// без БД для чтения всё идёт в основную БД
+	parcels, err = NewParcelStore(primary).GetByClient(parcel.Client)
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+}
+
+// TestDeliveredImmutable проверяет, что у доставленной посылки нельзя изменить адрес,
+// получателя и клиента: одиночные изменения отклоняются, массовые пропускают такую посылку
+func TestDeliveredImmutable(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	numbers, err := store.SeedParcels(1000, 2, "Unit %d")
+	require.NoError(t, err)
+	delivered, other := numbers[0], numbers[1]
+
+	require.NoError(t, store.SetStatus(delivered, ParcelStatusSent))
+	require.NoError(t, store.SetStatus(delivered, ParcelStatusDelivered))
+
+	// mutators
+	err = store.SetAddress(delivered, "new address")
+	require.ErrorIs(t, err, ErrParcelImmutable)
+
+	err = store.SetRecipient(delivered, "Пётр")
+	require.ErrorIs(t, err, ErrParcelImmutable)
+
+	// массовые операции пропускают доставленную посылку и меняют остальные
+	updated, err := store.SetRecipients(map[int]string{other: "Иван", delivered: "Пётр"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), updated)
+
+	normalized, err := store.NormalizeAddresses(strings.ToUpper)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), normalized)
+
+	_, err = db.Exec("UPDATE parcel SET address = ? WHERE number = ?", " Unit 1 ", delivered)
+	require.NoError(t, err)
+	report, err := store.Repair()
+	require.NoError(t, err)
+	require.Empty(t, report.TrimmedAddresses)
+
+	err = store.MoveClient(delivered, 2000, "merged accounts")
+	require.ErrorIs(t, err, ErrParcelImmutable)
+
+	err = store.SwapClients(other, delivered)
+	require.ErrorIs(t, err, ErrParcelImmutable)
+
+	// check
+	p, err := store.Get(delivered)
+	require.NoError(t, err)
+	require.Equal(t, " Unit 1 ", p.Address)
+	require.Empty(t, p.Recipient)
+	require.Equal(t, 1000, p.Client)
+
+	p, err = store.Get(other)
+	require.NoError(t, err)
+	require.Equal(t, "Иван", p.Recipient)
+	require.Equal(t, "UNIT 2", p.Address)
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ParcelQuery построитель запроса к посылкам с набором фильтров.
+// Фильтры объединяются через AND; каждый метод возвращает новый запрос,
+// не изменяя исходный
+type ParcelQuery struct {
+	store ParcelStore
+	conds []string
+	args  []any
+}
+
+// Query возвращает построитель запроса по всем посылкам хранилища
+func (s ParcelStore) Query() ParcelQuery {
+	return ParcelQuery{store: s}
+}
+
+// where добавляет к запросу условие cond с аргументами args
+func (q ParcelQuery) where(cond string, args ...any) ParcelQuery {
+	q.conds = append(slices.Clip(q.conds), cond)
+	q.args = append(slices.Clip(q.args), args...)
+	return q
+}
+
+// Client оставляет только посылки клиента client
+func (q ParcelQuery) Client(client int) ParcelQuery {
+	return q.where("client = ?", client)
+}
+
+// Status оставляет только посылки в статусе status
+func (q ParcelQuery) Status(status string) ParcelQuery {
+	return q.where("status = ?", status)
+}
+
+// CreatedBetween оставляет только посылки, созданные в промежутке [from, to).
+// created_at хранится в UTC в формате RFC3339, поэтому строки можно сравнивать напрямую
+func (q ParcelQuery) CreatedBetween(from, to time.Time) ParcelQuery {
+	return q.where("created_at >= ? AND created_at < ?",
+		from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+}
+
+// whereClause возвращает WHERE-часть запроса или пустую строку, если фильтров нет
+func (q ParcelQuery) whereClause() string {
+	if len(q.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conds, " AND ")
+}
+
+// All возвращает все посылки, подходящие под фильтры, упорядоченные по номеру
+func (q ParcelQuery) All() ([]Parcel, error) {
+	return q.store.queryParcels("Query.All", "SELECT "+parcelColumns+" FROM parcel"+q.whereClause()+" ORDER BY number",
+		q.args...)
+}
+
+// Count возвращает количество посылок, подходящих под фильтры, не читая сами посылки
+func (q ParcelQuery) Count() (int, error) {
+	var n int
+
+	err := q.store.reader().QueryRow("SELECT COUNT(*) FROM parcel"+q.whereClause(), q.args...).Scan(&n)
+	if err != nil {
+		return 0, checkClosed(err)
+	}
+
+	return n, nil
+}
+
+// Where возвращает посылки, подходящие под условие clause, упорядоченные по номеру.
+// clause — фрагмент WHERE, например "client = ? AND status = ?"; значения передаются
+// только через args и плейсхолдеры ?, подставлять их в clause нельзя — это SQL-инъекция
+func (s ParcelStore) Where(clause string, args ...any) ([]Parcel, error) {
+	if strings.TrimSpace(clause) == "" {
+		return nil, fmt.Errorf("empty where clause")
+	}
+
+	// скобки сохраняют приоритет OR внутри clause при объединении с другими условиями
+	q := s.Query().where("("+clause+")", args...)
+	return s.queryParcels("Where", "SELECT "+parcelColumns+" FROM parcel"+q.whereClause()+" ORDER BY number",
+		q.args...)
+}
+
+// GetByMonth возвращает посылки клиента client, созданные в заданном месяце (по UTC)
+func (s ParcelStore) GetByMonth(client, year, month int) ([]Parcel, error) {
+	if month < 1 || month > 12 {
+		return nil, fmt.Errorf("invalid month %d", month)
+	}
+
+	start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	// AddDate сам переносит декабрь на январь следующего года
+	end := start.AddDate(0, 1, 0)
+
+	return s.Query().Client(client).CreatedBetween(start, end).All()
+}
+
+// GetAllByPriority возвращает все посылки в порядке обработки: сначала registered,
+// затем sent, затем delivered; внутри статуса — от старых к новым
+func (s ParcelStore) GetAllByPriority() ([]Parcel, error) {
+	return s.queryParcels("GetAllByPriority", `SELECT `+parcelColumns+` FROM parcel
+		ORDER BY CASE status
+			WHEN :registered THEN 0
+			WHEN :sent THEN 1
+			WHEN :delivered THEN 2
+			ELSE 3
+		END, created_at, number`,
+		sql.Named("registered", ParcelStatusRegistered),
+		sql.Named("sent", ParcelStatusSent),
+		sql.Named("delivered", ParcelStatusDelivered))
+}
+
+// WeekendParcels возвращает посылки, созданные в субботу или воскресенье (по UTC)
+// в промежутке [from, to), упорядоченные по номеру
+func (s ParcelStore) WeekendParcels(from, to time.Time) ([]Parcel, error) {
+	// strftime('%w') возвращает день недели: 0 — воскресенье, 6 — суббота
+	q := s.Query().CreatedBetween(from, to).where("strftime('%w', created_at) IN ('0', '6')")
+	return s.queryParcels("WeekendParcels", "SELECT "+parcelColumns+" FROM parcel"+q.whereClause()+" ORDER BY number",
+		q.args...)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestQueryCount проверяет, что Count совпадает с количеством посылок из All для тех же фильтров
+func TestQueryCount(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	statuses := []string{ParcelStatusSent, ParcelStatusRegistered, ParcelStatusSent, ParcelStatusDelivered, ParcelStatusSent}
+	for i, status := range statuses {
+		parcel := getTestParcel()
+		parcel.Client = 1 + i%2
+		parcel.Status = status
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	queries := []ParcelQuery{
+		store.Query(),
+		store.Query().Status(ParcelStatusSent),
+		store.Query().Status(ParcelStatusSent).Client(2),
+		store.Query().Status(ParcelStatusDelivered).Client(2),
+	}
+	counts := []int{5, 3, 0, 1}
+
+	for i, q := range queries {
+		// count
+		n, err := q.Count()
+		require.NoError(t, err)
+		require.Equal(t, counts[i], n)
+
+		// all
+		parcels, err := q.All()
+		require.NoError(t, err)
+		require.Len(t, parcels, n)
+	}
+}
+
+// TestGetByMonth проверяет получение посылок клиента за календарный месяц
+func TestGetByMonth(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	dates := []string{
+		"2023-11-30T23:59:59Z",
+		"2023-12-01T00:00:00Z",
+		"2023-12-31T23:59:59Z",
+		"2024-01-01T00:00:00Z",
+	}
+	for _, date := range dates {
+		parcel := getTestParcel()
+		parcel.CreatedAt = date
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// get by month
+	parcels, err := store.GetByMonth(1000, 2023, 12)
+	require.NoError(t, err)
+	require.Len(t, parcels, 2)
+	require.Equal(t, dates[1], parcels[0].CreatedAt)
+	require.Equal(t, dates[2], parcels[1].CreatedAt)
+
+	parcels, err = store.GetByMonth(1001, 2023, 12)
+	require.NoError(t, err)
+	require.Empty(t, parcels)
+
+	_, err = store.GetByMonth(1000, 2023, 13)
+	require.Error(t, err)
+}
+
+// TestGetAllByPriority проверяет упорядочивание посылок по приоритету статуса
+func TestGetAllByPriority(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	seed := []struct {
+		status    string
+		createdAt string
+	}{
+		{ParcelStatusDelivered, "2024-01-01T00:00:00Z"},
+		{ParcelStatusSent, "2024-01-03T00:00:00Z"},
+		{ParcelStatusRegistered, "2024-01-04T00:00:00Z"},
+		{ParcelStatusSent, "2024-01-02T00:00:00Z"},
+		{ParcelStatusRegistered, "2024-01-05T00:00:00Z"},
+	}
+	for _, s := range seed {
+		parcel := getTestParcel()
+		parcel.Status = s.status
+		parcel.CreatedAt = s.createdAt
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// get by priority
+	parcels, err := store.GetAllByPriority()
+	require.NoError(t, err)
+	require.Len(t, parcels, len(seed))
+
+	var order []string
+	for _, p := range parcels {
+		order = append(order, p.Status+" "+p.CreatedAt)
+	}
+	require.Equal(t, []string{
+		"registered 2024-01-04T00:00:00Z",
+		"registered 2024-01-05T00:00:00Z",
+		"sent 2024-01-02T00:00:00Z",
+		"sent 2024-01-03T00:00:00Z",
+		"delivered 2024-01-01T00:00:00Z",
+	}, order)
+}
+
+// TestWhere проверяет выборку по произвольному условию с плейсхолдерами
+func TestWhere(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	sent, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(sent, ParcelStatusSent))
+
+	_, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	other := getTestParcel()
+	other.Client = 2000
+	otherID, err := store.Add(other)
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(otherID, ParcelStatusSent))
+
+	// check
+	found, err := store.Where("client = ? AND status = ?", 1000, ParcelStatusSent)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, sent, found[0].Number)
+
+	found, err = store.Where("client = ? OR status = ?", 2000, ParcelStatusSent)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+
+	_, err = store.Where(" ")
+	require.Error(t, err)
+}
+
+// TestWeekendParcels проверяет выборку посылок, созданных в выходные
+func TestWeekendParcels(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	// 2024-03-01 — пятница
+	dates := []string{
+		"2024-03-01T23:59:59Z", // пятница
+		"2024-03-02T00:00:00Z", // суббота
+		"2024-03-03T12:00:00Z", // воскресенье
+		"2024-03-04T00:00:00Z", // понедельник
+		"2024-03-09T12:00:00Z", // суббота вне промежутка
+	}
+	numbers := make([]int, len(dates))
+	for i, createdAt := range dates {
+		parcel := getTestParcel()
+		parcel.CreatedAt = createdAt
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		numbers[i] = id
+	}
+
+	// check
+	from := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, time.March, 8, 0, 0, 0, 0, time.UTC)
+
+	found, err := store.WeekendParcels(from, to)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, numbers[1], found[0].Number)
+	require.Equal(t, numbers[2], found[1].Number)
+}
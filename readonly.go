@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+)
+
+// ErrReadOnly возвращается при попытке изменить данные через хранилище только для чтения
+var ErrReadOnly = errors.New("parcel store is read-only")
+
+// ReadOnlyParcelStore хранилище посылок, допускающее только чтение.
+// Изменяющие методы ничего не делают с БД и возвращают ErrReadOnly
+type ReadOnlyParcelStore struct {
+	store ParcelStore
+}
+
+// ReadOnly возвращает обёртку над хранилищем, запрещающую изменения
+func (s ParcelStore) ReadOnly() ReadOnlyParcelStore {
+	return ReadOnlyParcelStore{store: s}
+}
+
+func (s ReadOnlyParcelStore) Get(number int) (Parcel, error) {
+	return s.store.Get(number)
+}
+
+func (s ReadOnlyParcelStore) GetByClient(client int) ([]Parcel, error) {
+	return s.store.GetByClient(client)
+}
+
+func (s ReadOnlyParcelStore) Add(p Parcel) (int, error) {
+	return 0, ErrReadOnly
+}
+
+func (s ReadOnlyParcelStore) SetStatus(number int, status string) error {
+	return ErrReadOnly
+}
+
+func (s ReadOnlyParcelStore) SetAddress(number int, address string) error {
+	return ErrReadOnly
+}
+
+func (s ReadOnlyParcelStore) Delete(number int) error {
+	return ErrReadOnly
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestReadOnly проверяет, что хранилище только для чтения не даёт изменять посылки
+func TestReadOnly(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+	parcel := getTestParcel()
+
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+	parcel.Number = id
+
+	defer store.Delete(id)
+
+	readOnly := store.ReadOnly()
+
+	// add
+	_, err = readOnly.Add(getTestParcel())
+	require.ErrorIs(t, err, ErrReadOnly)
+
+	// get
+	stored, err := readOnly.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, parcel, stored)
+
+	// delete
+	err = readOnly.Delete(id)
+	require.ErrorIs(t, err, ErrReadOnly)
+
+	_, err = store.Get(id)
+	require.NoError(t, err)
+}
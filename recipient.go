@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SetRecipient задаёт получателя одной посылке. Имя очищается от пробелов по краям,
+// пустое имя отклоняется. Как и SetAddress, меняет только посылки в статусе registered,
+// для доставленной посылки возвращает ErrParcelImmutable
+func (s ParcelStore) SetRecipient(number int, recipient string) error {
+	defer s.observe("SetRecipient", "", time.Now())
+
+	recipient = strings.TrimSpace(recipient)
+	if recipient == "" {
+		return fmt.Errorf("%w: empty recipient for parcel %d", ErrInvalidParcel, number)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	err = checkMutable(tx, number)
+	if errors.Is(err, ErrParcelNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE parcel SET recipient = :recipient, updated_at = :updated_at WHERE number = :number AND status = :status",
+		sql.Named("recipient", recipient),
+		sql.Named("updated_at", time.Now().UTC().Format(time.RFC3339)),
+		sql.Named("number", number),
+		sql.Named("status", ParcelStatusRegistered))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetRecipients задаёт получателей посылкам: ключ — номер посылки, значение — имя получателя.
+// Имена очищаются от пробелов по краям, пустое имя отклоняет все изменения.
+// Как и адрес, получателя можно менять только у посылок в статусе registered,
+// остальные посылки, в том числе доставленные, пропускаются.
+// Возвращает количество обновлённых посылок
+func (s ParcelStore) SetRecipients(updates map[int]string) (int64, error) {
+	defer s.observe("SetRecipients", "", time.Now())
+
+	recipients := make(map[int]string, len(updates))
+	for number, recipient := range updates {
+		recipient = strings.TrimSpace(recipient)
+		if recipient == "" {
+			return 0, fmt.Errorf("%w: empty recipient for parcel %d", ErrInvalidParcel, number)
+		}
+		recipients[number] = recipient
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	var updated int64
+	for number, recipient := range recipients {
+		res, err := tx.Exec("UPDATE parcel SET recipient = :recipient, updated_at = :updated_at WHERE number = :number AND status = :status",
+			sql.Named("recipient", recipient),
+			sql.Named("updated_at", now),
+			sql.Named("number", number),
+			sql.Named("status", ParcelStatusRegistered))
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		updated += n
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return updated, nil
+}
+
+// MissingRecipient возвращает посылки без получателя, например добавленные
+// до появления поля recipient, чтобы их можно было заполнить
+func (s ParcelStore) MissingRecipient() ([]Parcel, error) {
+	return s.queryParcels("MissingRecipient",
+		"SELECT "+parcelColumns+" FROM parcel WHERE recipient IS NULL OR trim(recipient) = '' ORDER BY number")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSetRecipients проверяет массовое изменение получателей
+func TestSetRecipients(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+
+	var numbers []int
+	for i := 0; i < 3; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	err = store.SetStatus(numbers[2], ParcelStatusSent)
+	require.NoError(t, err)
+
+	// empty name
+	_, err = store.SetRecipients(map[int]string{numbers[0]: "Иван Петров", numbers[1]: "  "})
+	require.ErrorIs(t, err, ErrInvalidParcel)
+
+	stored, err := store.Get(numbers[0])
+	require.NoError(t, err)
+	require.Empty(t, stored.Recipient)
+
+	// set recipients
+	updated, err := store.SetRecipients(map[int]string{
+		numbers[0]: " Иван Петров ",
+		numbers[1]: "Мария Иванова",
+		numbers[2]: "Пётр Сидоров",
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, updated)
+
+	// check
+	stored, err = store.Get(numbers[0])
+	require.NoError(t, err)
+	require.Equal(t, "Иван Петров", stored.Recipient)
+
+	stored, err = store.Get(numbers[2])
+	require.NoError(t, err)
+	require.Empty(t, stored.Recipient)
+}
+
+// TestSetRecipient проверяет изменение получателя одной посылки
+func TestSetRecipient(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+
+	registered, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	sent, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(sent, ParcelStatusSent))
+
+	// empty name
+	err = store.SetRecipient(registered, "  ")
+	require.ErrorIs(t, err, ErrInvalidParcel)
+
+	// set recipient
+	require.NoError(t, store.SetRecipient(registered, " Иван Петров "))
+	require.NoError(t, store.SetRecipient(sent, "Пётр Сидоров"))
+
+	// check
+	stored, err := store.Get(registered)
+	require.NoError(t, err)
+	require.Equal(t, "Иван Петров", stored.Recipient)
+
+	stored, err = store.Get(sent)
+	require.NoError(t, err)
+	require.Empty(t, stored.Recipient)
+}
+
+// TestRecipient проверяет сохранение получателя при добавлении и копировании посылки
+func TestRecipient(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+	parcel := getTestParcel()
+	parcel.Recipient = "Иван Петров"
+
+	// add
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	parcel.Number = id
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, parcel, stored)
+
+	// duplicate
+	copyID, err := store.Duplicate(id)
+	require.NoError(t, err)
+
+	stored, err = store.Get(copyID)
+	require.NoError(t, err)
+	require.Equal(t, parcel.Recipient, stored.Recipient)
+
+	receipt, err := store.FormatReceipt(copyID)
+	require.NoError(t, err)
+	require.Contains(t, receipt, "Получатель: "+parcel.Recipient)
+}
+
+// TestMissingRecipient проверяет поиск посылок без получателя
+func TestMissingRecipient(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	withRecipient := getTestParcel()
+	withRecipient.Recipient = "Иван Петров"
+	_, err := store.Add(withRecipient)
+	require.NoError(t, err)
+
+	empty, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	blank := getTestParcel()
+	blank.Recipient = "  "
+	blankID, err := store.Add(blank)
+	require.NoError(t, err)
+
+	// check
+	missing, err := store.MissingRecipient()
+	require.NoError(t, err)
+	require.Len(t, missing, 2)
+	require.Equal(t, empty, missing[0].Number)
+	require.Equal(t, blankID, missing[1].Number)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// RepairReport описывает изменения, внесённые Repair
+type RepairReport struct {
+	// TrimmedAddresses номера посылок, у адресов которых убраны пробелы по краям
+	TrimmedAddresses []int
+	// Quarantined номера посылок с неизвестным статусом, переведённых в ParcelStatusQuarantine
+	Quarantined []int
+	// SequenceReconciled сообщает, что счётчик autoincrement пришлось поднять (см. ReconcileSequence)
+	SequenceReconciled bool
+}
+
+// Repair исправляет типичные ошибки данных, попавших в БД в обход хранилища: убирает пробелы
+// по краям адресов, переводит посылки с неизвестным статусом в ParcelStatusQuarantine
+// и поднимает отставший счётчик autoincrement. Все исправления выполняются в одной транзакции.
+// Адреса доставленных посылок и адреса, состоящие только из пробелов, не меняются
+func (s ParcelStore) Repair() (RepairReport, error) {
+	defer s.observe("Repair", "", time.Now())
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return RepairReport{}, checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	report := RepairReport{}
+
+	// TRIM без второго аргумента убирает только пробелы, поэтому перечисляем и остальные пробельные символы
+	report.TrimmedAddresses, err = repairNumbers(tx, `UPDATE parcel SET address = TRIM(address, :blank), updated_at = :updated_at
+		WHERE address <> TRIM(address, :blank) AND TRIM(address, :blank) <> '' AND status <> :delivered
+		RETURNING number`,
+		sql.Named("blank", " \t\r\n"),
+		sql.Named("updated_at", now),
+		sql.Named("delivered", ParcelStatusDelivered))
+	if err != nil {
+		return RepairReport{}, err
+	}
+
+	report.Quarantined, err = quarantineUnknownStatuses(tx, now)
+	if err != nil {
+		return RepairReport{}, err
+	}
+
+	report.SequenceReconciled, err = reconcileSequence(tx)
+	if err != nil {
+		return RepairReport{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return RepairReport{}, err
+	}
+
+	return report, nil
+}
+
+// repairNumbers выполняет запрос, возвращающий номера изменённых посылок,
+// и возвращает их по возрастанию
+func repairNumbers(tx *sql.Tx, query string, args ...any) ([]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var numbers []int
+	for rows.Next() {
+		var number int
+		err := rows.Scan(&number)
+		if err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, number)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// порядок строк в RETURNING не определён
+	slices.Sort(numbers)
+	return numbers, nil
+}
+
+// quarantineUnknownStatuses переводит посылки с неизвестным статусом в ParcelStatusQuarantine,
+// записывает прежний статус в историю как причину и возвращает номера посылок по возрастанию
+func quarantineUnknownStatuses(tx *sql.Tx, now string) ([]int, error) {
+	rows, err := tx.Query(`SELECT number, status FROM parcel
+		WHERE status NOT IN (:registered, :sent, :delivered, :quarantine) ORDER BY number`,
+		sql.Named("registered", ParcelStatusRegistered),
+		sql.Named("sent", ParcelStatusSent),
+		sql.Named("delivered", ParcelStatusDelivered),
+		sql.Named("quarantine", ParcelStatusQuarantine))
+	if err != nil {
+		return nil, err
+	}
+
+	unknown := map[int]string{}
+	var numbers []int
+	for rows.Next() {
+		var number int
+		var status string
+
+		err := rows.Scan(&number, &status)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		unknown[number] = status
+		numbers = append(numbers, number)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, number := range numbers {
+		_, err := tx.Exec("UPDATE parcel SET status = :quarantine, updated_at = :updated_at WHERE number = :number",
+			sql.Named("quarantine", ParcelStatusQuarantine),
+			sql.Named("updated_at", now),
+			sql.Named("number", number))
+		if err != nil {
+			return nil, err
+		}
+
+		// запись с причиной сохраняется всегда, как при CorrectStatus
+		err = addStatusEvent(tx, number, ParcelStatusQuarantine, now, fmt.Sprintf("repair: unknown status %q", unknown[number]))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return numbers, nil
+}
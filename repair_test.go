@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRepair проверяет исправление данных, испорченных в обход хранилища
+func TestRepair(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	numbers, err := store.SeedParcels(1000, 4, "Unit %d")
+	require.NoError(t, err)
+
+	_, err = db.Exec("UPDATE parcel SET address = ? WHERE number = ?", "  Unit 1\t", numbers[0])
+	require.NoError(t, err)
+	_, err = db.Exec("UPDATE parcel SET address = ? WHERE number = ?", "   ", numbers[1])
+	require.NoError(t, err)
+	_, err = db.Exec("UPDATE parcel SET status = ? WHERE number = ?", "lost", numbers[2])
+	require.NoError(t, err)
+	_, err = db.Exec("UPDATE sqlite_sequence SET seq = 1 WHERE name = 'parcel'")
+	require.NoError(t, err)
+
+	// repair
+	report, err := store.Repair()
+	require.NoError(t, err)
+	require.Equal(t, []int{numbers[0]}, report.TrimmedAddresses)
+	require.Equal(t, []int{numbers[2]}, report.Quarantined)
+	require.True(t, report.SequenceReconciled)
+
+	// check
+	p, err := store.Get(numbers[0])
+	require.NoError(t, err)
+	require.Equal(t, "Unit 1", p.Address)
+
+	p, err = store.Get(numbers[2])
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusQuarantine, p.Status)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.Greater(t, id, numbers[3])
+
+	_, history, err := store.GetWithHistory(numbers[2])
+	require.NoError(t, err)
+	require.NotEmpty(t, history)
+	require.Equal(t, ParcelStatusQuarantine, history[len(history)-1].Status)
+	require.Equal(t, `repair: unknown status "lost"`, history[len(history)-1].Reason)
+
+	// после исправления остаётся только адрес из одних пробелов, который Repair не трогает
+	issues, err := store.CheckIntegrity()
+	require.NoError(t, err)
+	require.Equal(t, []string{fmt.Sprintf("parcel %d: empty address", numbers[1])}, issues)
+
+	mismatches, err := store.StatusMismatches()
+	require.NoError(t, err)
+	require.Empty(t, mismatches)
+
+	// повторный запуск ничего не меняет
+	report, err = store.Repair()
+	require.NoError(t, err)
+	require.Equal(t, RepairReport{}, report)
+
+	// посылки на карантине можно удалить по статусу
+	deleted, err := store.DeleteByStatus(ParcelStatusQuarantine)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// schema описание таблиц, необходимых хранилищу посылок
+const schema = `
+CREATE TABLE IF NOT EXISTS parcel
+(
+    number     integer
+        constraint parcel_pk
+            primary key autoincrement,
+    client     integer      not null,
+    status     VARCHAR(128) not null,
+    address    VARCHAR(512) not null,
+    created_at text         not null
+);
+
+CREATE TABLE IF NOT EXISTS status_history
+(
+    id         integer
+        constraint status_history_pk
+            primary key autoincrement,
+    number     integer      not null,
+    status     VARCHAR(128) not null,
+    changed_at text         not null,
+    reason     text         not null default ''
+);
+
+CREATE INDEX IF NOT EXISTS status_history_number_idx ON status_history (number);
+
+CREATE TABLE IF NOT EXISTS parcel_labels
+(
+    number integer      not null,
+    label  VARCHAR(128) not null,
+    constraint parcel_labels_pk
+        primary key (number, label)
+);
+
+CREATE INDEX IF NOT EXISTS parcel_labels_label_idx ON parcel_labels (label);
+
+CREATE TABLE IF NOT EXISTS schema_version
+(
+    version    integer not null
+        constraint schema_version_pk
+            primary key,
+    applied_at text    not null
+);
+`
+
+// baseSchemaVersion версия схемы, которую создаёт EnsureSchema
+const baseSchemaVersion = 1
+
+// EnsureSchema создаёт недостающие таблицы и, если версия схемы ещё не записана,
+// записывает baseSchemaVersion
+func (s ParcelStore) EnsureSchema() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(schema)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO schema_version (version, applied_at) SELECT :version, :applied_at WHERE NOT EXISTS (SELECT 1 FROM schema_version)",
+		sql.Named("version", baseSchemaVersion),
+		sql.Named("applied_at", time.Now().UTC().Format(time.RFC3339)))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SchemaVersion возвращает текущую версию схемы БД или 0, если версия не записана
+// или таблицы schema_version ещё нет
+func (s ParcelStore) SchemaVersion() (int, error) {
+	var exists bool
+
+	err := s.db.QueryRow("SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'").Scan(&exists)
+	if err != nil {
+		return 0, checkClosed(err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+
+	err = s.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, checkClosed(err)
+	}
+
+	return version, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSchemaVersion проверяет запись версии схемы в EnsureSchema
+func TestSchemaVersion(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tracker.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+
+	// ensure schema
+	err = store.EnsureSchema()
+	require.NoError(t, err)
+
+	version, err := store.SchemaVersion()
+	require.NoError(t, err)
+	require.Equal(t, 1, version)
+
+	// повторный вызов не меняет версию
+	err = store.EnsureSchema()
+	require.NoError(t, err)
+
+	version, err = store.SchemaVersion()
+	require.NoError(t, err)
+	require.Equal(t, 1, version)
+}
+
+// TestMigrate проверяет миграцию схемы версии 1 на версию 2
+func TestMigrate(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tracker.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+
+	err = store.Migrate(2)
+	require.ErrorIs(t, err, ErrSchemaNotInitialized)
+
+	err = store.EnsureSchema()
+	require.NoError(t, err)
+
+	_, err = db.Exec("SELECT updated_at FROM parcel")
+	require.Error(t, err)
+
+	// migrate
+	err = store.Migrate(2)
+	require.NoError(t, err)
+
+	// check
+	version, err := store.SchemaVersion()
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+
+	_, err = db.Exec("SELECT updated_at FROM parcel")
+	require.NoError(t, err)
+
+	// повторная миграция ничего не делает, откат не поддерживается
+	err = store.Migrate(2)
+	require.NoError(t, err)
+	err = store.Migrate(1)
+	require.Error(t, err)
+}
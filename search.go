@@ -0,0 +1,80 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"modernc.org/sqlite"
+)
+
+func init() {
+	// встроенные в SQLite LOWER и COLLATE NOCASE меняют регистр только у ASCII-символов,
+	// а адреса у нас в основном на кириллице, поэтому регистрируем свою функцию
+	sqlite.MustRegisterDeterministicScalarFunction("unicode_lower", 1,
+		func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			s, ok := args[0].(string)
+			if !ok {
+				return args[0], nil
+			}
+			return strings.ToLower(s), nil
+		})
+
+	// оператор X REGEXP Y в SQLite вызывает функцию regexp(Y, X), своей реализации у SQLite нет
+	sqlite.MustRegisterDeterministicScalarFunction("regexp", 2,
+		func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			pattern, ok := args[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("regexp: pattern must be a string")
+			}
+			s, ok := args[1].(string)
+			if !ok {
+				return false, nil
+			}
+			re, err := compileRegexp(pattern)
+			if err != nil {
+				return nil, err
+			}
+			return re.MatchString(s), nil
+		})
+}
+
+// regexpCache скомпилированные выражения, чтобы не компилировать шаблон для каждой строки
+var regexpCache sync.Map
+
+// compileRegexp возвращает скомпилированное выражение pattern из кэша
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexpCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexpCache.Store(pattern, re)
+	return re, nil
+}
+
+// SearchByAddressCI возвращает посылки, адрес которых содержит fragment без учёта регистра.
+// Регистр приводится с учётом Unicode, поэтому поиск работает и для кириллицы
+func (s ParcelStore) SearchByAddressCI(fragment string) ([]Parcel, error) {
+	return s.queryParcels("SearchByAddressCI", "SELECT "+parcelColumns+" FROM parcel WHERE instr(unicode_lower(address), unicode_lower(:fragment)) > 0 ORDER BY number",
+		sql.Named("fragment", fragment))
+}
+
+// SearchByAddressRegex возвращает посылки, адрес которых соответствует регулярному выражению pattern
+// в синтаксисе пакета regexp. Фильтрация выполняется в SQLite оператором REGEXP,
+// для которого в init зарегистрирована функция на основе regexp
+func (s ParcelStore) SearchByAddressRegex(pattern string) ([]Parcel, error) {
+	// проверяем шаблон заранее, чтобы вернуть понятную ошибку, а не ошибку выполнения запроса
+	_, err := compileRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.queryParcels("SearchByAddressRegex", "SELECT "+parcelColumns+" FROM parcel WHERE address REGEXP :pattern ORDER BY number",
+		sql.Named("pattern", pattern))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSearchByAddressCI проверяет поиск по части адреса без учёта регистра
+func TestSearchByAddressCI(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	addresses := []string{"12 Main Street", "Псков, ул. Колотушкина", "Other Road"}
+	for _, address := range addresses {
+		parcel := getTestParcel()
+		parcel.Address = address
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// search
+	found, err := store.SearchByAddressCI("main")
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "12 Main Street", found[0].Address)
+
+	found, err = store.SearchByAddressCI("КОЛОТУШКИНА")
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "Псков, ул. Колотушкина", found[0].Address)
+
+	found, err = store.SearchByAddressCI("nowhere")
+	require.NoError(t, err)
+	require.Empty(t, found)
+}
+
+// TestSearchByAddressRegex проверяет поиск по регулярному выражению
+func TestSearchByAddressRegex(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	addresses := []string{"12 Main Street", "Псков, ул. Колотушкина", "Other Road, 7"}
+	for _, address := range addresses {
+		parcel := getTestParcel()
+		parcel.Address = address
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// search
+	found, err := store.SearchByAddressRegex(`\d`)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, "12 Main Street", found[0].Address)
+	require.Equal(t, "Other Road, 7", found[1].Address)
+
+	found, err = store.SearchByAddressRegex(`^\d+ `)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "12 Main Street", found[0].Address)
+
+	_, err = store.SearchByAddressRegex(`(`)
+	require.Error(t, err)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// postalCodePattern почтовый индекс в адресе: отдельно стоящие 5 или 6 цифр,
+// чтобы номера домов и квартир не принимались за индекс
+var postalCodePattern = regexp.MustCompile(`\b\d{5,6}\b`)
+
+// FilterServiceable делит посылки на те, что можно доставить, и остальные:
+// посылку можно доставить, если почтовый индекс в её адресе начинается
+// с одного из servedPrefixes. Посылки без индекса считаются недоставляемыми.
+// Порядок посылок в обеих частях сохраняется
+func FilterServiceable(parcels []Parcel, servedPrefixes []string) (serviceable, unserviceable []Parcel) {
+	for _, p := range parcels {
+		if isServiceable(p.Address, servedPrefixes) {
+			serviceable = append(serviceable, p)
+		} else {
+			unserviceable = append(unserviceable, p)
+		}
+	}
+	return serviceable, unserviceable
+}
+
+// isServiceable сообщает, начинается ли какой-либо индекс в address с одного из prefixes
+func isServiceable(address string, prefixes []string) bool {
+	for _, code := range postalCodePattern.FindAllString(address, -1) {
+		for _, prefix := range prefixes {
+			if prefix != "" && strings.HasPrefix(code, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestFilterServiceable проверяет разделение посылок по почтовым индексам
+func TestFilterServiceable(t *testing.T) {
+	parcels := []Parcel{
+		{Number: 1, Address: "101000, Москва, ул. Мясницкая, д. 10"},
+		{Number: 2, Address: "Санкт-Петербург, Невский пр., 28, 191186"},
+		{Number: 3, Address: "620014, Екатеринбург, ул. Ленина, 1"},
+		{Number: 4, Address: "Москва, ул. Тверская, д. 101"},
+		{Number: 5, Address: "Псков, 180000"},
+	}
+
+	serviceable, unserviceable := FilterServiceable(parcels, []string{"10", "19", ""})
+
+	numbers := func(parcels []Parcel) []int {
+		var res []int
+		for _, p := range parcels {
+			res = append(res, p.Number)
+		}
+		return res
+	}
+	require.Equal(t, []int{1, 2}, numbers(serviceable))
+	// у посылки 4 нет индекса, номер дома 101 индексом не считается
+	require.Equal(t, []int{3, 4, 5}, numbers(unserviceable))
+
+	serviceable, unserviceable = FilterServiceable(parcels, nil)
+	require.Empty(t, serviceable)
+	require.Len(t, unserviceable, len(parcels))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// WithSLA возвращает копию хранилища с допустимым временем нахождения посылки в каждом статусе.
+// Статусы, которых нет в sla, не ограничены
+func (s ParcelStore) WithSLA(sla map[string]time.Duration) ParcelStore {
+	s.sla = maps.Clone(sla)
+	return s
+}
+
+// SLABreaches возвращает посылки, которые находятся в текущем статусе дольше, чем допускает SLA,
+// заданный через WithSLA. Время входа в статус берётся из истории статусов, а если истории нет —
+// из updated_at или created_at
+func (s ParcelStore) SLABreaches() ([]Parcel, error) {
+	if len(s.sla) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	var conds []string
+	var args []any
+
+	// сортируем статусы, чтобы текст запроса не зависел от порядка обхода map
+	statuses := make([]string, 0, len(s.sla))
+	for status := range s.sla {
+		statuses = append(statuses, status)
+	}
+	slices.Sort(statuses)
+
+	for _, status := range statuses {
+		conds = append(conds, "(p.status = ? AND COALESCE(MAX(h.changed_at), p.updated_at, p.created_at) < ?)")
+		args = append(args, status, now.Add(-s.sla[status]).UTC().Format(time.RFC3339))
+	}
+
+	return s.queryParcels("SLABreaches", `SELECT `+parcelColumnsOf("p")+`
+		FROM parcel p LEFT JOIN status_history h ON h.number = p.number
+		GROUP BY p.number
+		HAVING `+strings.Join(conds, " OR ")+`
+		ORDER BY p.number`,
+		args...)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSLABreaches проверяет поиск посылок, превысивших допустимое время в статусе
+func TestSLABreaches(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db).WithSLA(map[string]time.Duration{
+		ParcelStatusRegistered: 48 * time.Hour,
+		ParcelStatusSent:       24 * time.Hour,
+	})
+
+	createdAt := time.Now().Add(-36 * time.Hour).UTC().Format(time.RFC3339)
+
+	// registered 36 часов назад — в пределах SLA
+	registered := getTestParcel()
+	registered.CreatedAt = createdAt
+	_, err := store.Add(registered)
+	require.NoError(t, err)
+
+	// sent 36 часов назад — SLA нарушен
+	sent := registered
+	sent.Status = ParcelStatusSent
+	breach, err := store.Add(sent)
+	require.NoError(t, err)
+
+	// delivered не ограничен SLA
+	delivered := registered
+	delivered.Status = ParcelStatusDelivered
+	_, err = store.Add(delivered)
+	require.NoError(t, err)
+
+	// breaches
+	parcels, err := store.SLABreaches()
+	require.NoError(t, err)
+	require.Len(t, parcels, 1)
+	require.Equal(t, breach, parcels[0].Number)
+
+	// без SLA нарушений нет
+	parcels, err = NewParcelStore(db).SLABreaches()
+	require.NoError(t, err)
+	require.Empty(t, parcels)
+}
+
+// TestSLABreachesWithoutHistory проверяет, что без истории статусов время входа в статус
+// берётся из updated_at, а не из created_at
+func TestSLABreachesWithoutHistory(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t)).WithSLA(map[string]time.Duration{
+		ParcelStatusSent: 24 * time.Hour,
+	})
+
+	// посылка создана 30 дней назад, но отправлена только что
+	parcel := getTestParcel()
+	parcel.CreatedAt = time.Now().Add(-30 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	id, err := store.Add(parcel)
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+
+	// breaches
+	parcels, err := store.SLABreaches()
+	require.NoError(t, err)
+	require.Empty(t, parcels)
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AddressCount количество посылок, отправленных на один адрес
+type AddressCount struct {
+	Address string
+	Count   int
+}
+
+// TopAddresses возвращает не более limit адресов с наибольшим количеством посылок.
+// Адреса упорядочены по убыванию количества, при равенстве — по самому адресу
+func (s ParcelStore) TopAddresses(limit int) ([]AddressCount, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive, got %d", limit)
+	}
+
+	rows, err := s.reader().Query("SELECT address, COUNT(*) AS cnt FROM parcel GROUP BY address ORDER BY cnt DESC, address LIMIT :limit",
+		sql.Named("limit", limit))
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	var res []AddressCount
+	for rows.Next() {
+		c := AddressCount{}
+
+		err := rows.Scan(&c.Address, &c.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ClientTotals возвращает количество посылок каждого клиента одним запросом.
+// Для пустой таблицы возвращается пустой map
+func (s ParcelStore) ClientTotals() (map[int]int, error) {
+	rows, err := s.reader().Query("SELECT client, COUNT(*) FROM parcel GROUP BY client")
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	res := map[int]int{}
+	for rows.Next() {
+		var client, count int
+
+		err := rows.Scan(&client, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		res[client] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ClientDeliveryRates возвращает для каждого клиента долю его посылок в статусе delivered,
+// от 0 до 1. Клиенты без посылок в результат не попадают
+func (s ParcelStore) ClientDeliveryRates() (map[int]float64, error) {
+	rows, err := s.reader().Query("SELECT client, AVG(status = :delivered) FROM parcel GROUP BY client",
+		sql.Named("delivered", ParcelStatusDelivered))
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	res := map[int]float64{}
+	for rows.Next() {
+		var client int
+		var rate float64
+
+		err := rows.Scan(&client, &rate)
+		if err != nil {
+			return nil, err
+		}
+
+		res[client] = rate
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// AgeBuckets распределяет посылки по возрасту. buckets — возрастающие границы,
+// например 24h, 7*24h, 30*24h. Элемент i результата — количество посылок
+// возрастом от buckets[i-1] до buckets[i], последний элемент — посылки старше buckets[len(buckets)-1]
+func (s ParcelStore) AgeBuckets(buckets []time.Duration) ([]int, error) {
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("no age buckets")
+	}
+	for i, b := range buckets {
+		if b <= 0 || (i > 0 && b <= buckets[i-1]) {
+			return nil, fmt.Errorf("age buckets must be positive and ascending, got %v", buckets)
+		}
+	}
+
+	// возраст меньше b, если посылка создана позже now-b;
+	// created_at хранится в UTC в формате RFC3339, поэтому строки сравниваются напрямую
+	now := time.Now()
+	var query strings.Builder
+	args := make([]any, 0, len(buckets))
+
+	query.WriteString("SELECT CASE")
+	for i, b := range buckets {
+		fmt.Fprintf(&query, " WHEN created_at > ? THEN %d", i)
+		args = append(args, now.Add(-b).UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(&query, " ELSE %d END AS bucket, COUNT(*) FROM parcel GROUP BY bucket", len(buckets))
+
+	rows, err := s.reader().Query(query.String(), args...)
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	res := make([]int, len(buckets)+1)
+	for rows.Next() {
+		var bucket, count int
+
+		err := rows.Scan(&bucket, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		res[bucket] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// StatusCountsInRange возвращает количество посылок в каждом статусе среди созданных
+// в промежутке [from, to). Статусы без посылок в результат не попадают
+func (s ParcelStore) StatusCountsInRange(from, to time.Time) (map[string]int, error) {
+	q := s.Query().CreatedBetween(from, to)
+
+	rows, err := s.reader().Query("SELECT status, COUNT(*) FROM parcel"+q.whereClause()+" GROUP BY status", q.args...)
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	res := map[string]int{}
+	for rows.Next() {
+		var status string
+		var count int
+
+		err := rows.Scan(&status, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		res[status] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// DailyCounts возвращает количество посылок, созданных в промежутке [from, to), по дням.
+// Ключ — дата в формате YYYY-MM-DD по UTC, дни без посылок в результат не попадают
+func (s ParcelStore) DailyCounts(from, to time.Time) (map[string]int, error) {
+	q := s.Query().CreatedBetween(from, to)
+
+	rows, err := s.reader().Query("SELECT date(created_at) AS day, COUNT(*) FROM parcel"+q.whereClause()+" GROUP BY day", q.args...)
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	res := map[string]int{}
+	for rows.Next() {
+		var day string
+		var count int
+
+		err := rows.Scan(&day, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		res[day] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Throughput возвращает количество посылок, созданных в каждом из последних buckets
+// последовательных окон длиной window, от самого старого окна к текущему.
+// Последнее окно заканчивается текущим моментом включительно, например
+// Throughput(time.Hour, 24) даёт почасовую нагрузку за сутки.
+// window должен быть целым числом секунд, так как created_at хранится с точностью до секунды
+func (s ParcelStore) Throughput(window time.Duration, buckets int) ([]int, error) {
+	if window < time.Second || window%time.Second != 0 {
+		return nil, fmt.Errorf("window must be a positive whole number of seconds, got %s", window)
+	}
+	if buckets <= 0 {
+		return nil, fmt.Errorf("buckets must be positive, got %d", buckets)
+	}
+
+	end := time.Now().UTC().Truncate(time.Second)
+	start := end.Add(-window * time.Duration(buckets))
+	// created_at хранится с точностью до секунды, поэтому граница +1с включает текущую секунду
+	q := s.Query().CreatedBetween(start, end.Add(time.Second))
+	// плейсхолдеры фильтров позиционные, поэтому аргументы SELECT идут перед ними
+	args := append([]any{start.Unix(), int64(window / time.Second)}, q.args...)
+
+	rows, err := s.reader().Query(`SELECT (CAST(strftime('%s', created_at) AS integer) - ?) / ? AS bucket, COUNT(*)
+		FROM parcel`+q.whereClause()+` GROUP BY bucket`, args...)
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	counts := make([]int, buckets)
+	for rows.Next() {
+		var bucket, count int
+
+		err := rows.Scan(&bucket, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		// посылки, созданные ровно в конце последнего окна, относятся к нему
+		counts[min(bucket, buckets-1)] += count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// SharedAddresses возвращает адреса, на которые отправляли посылки несколько разных клиентов,
+// вместе с идентификаторами этих клиентов по возрастанию. Помогает находить пункты выдачи
+func (s ParcelStore) SharedAddresses() (map[string][]int, error) {
+	rows, err := s.reader().Query(`SELECT DISTINCT address, client FROM parcel
+		WHERE address IN (SELECT address FROM parcel GROUP BY address HAVING COUNT(DISTINCT client) > 1)
+		ORDER BY address, client`)
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	res := map[string][]int{}
+	for rows.Next() {
+		var address string
+		var client int
+
+		err := rows.Scan(&address, &client)
+		if err != nil {
+			return nil, err
+		}
+
+		res[address] = append(res[address], client)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// TimeBounds возвращает даты создания самой старой и самой новой посылок.
+// Если посылок нет, обе даты нулевые (IsZero возвращает true)
+func (s ParcelStore) TimeBounds() (oldest, newest time.Time, err error) {
+	var minCreatedAt, maxCreatedAt sql.NullString
+
+	err = s.reader().QueryRow("SELECT MIN(created_at), MAX(created_at) FROM parcel").Scan(&minCreatedAt, &maxCreatedAt)
+	if err != nil {
+		return time.Time{}, time.Time{}, checkClosed(err)
+	}
+	if !minCreatedAt.Valid {
+		return time.Time{}, time.Time{}, nil
+	}
+
+	oldest, err = time.Parse(time.RFC3339, minCreatedAt.String)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("parse oldest created_at: %w", err)
+	}
+	newest, err = time.Parse(time.RFC3339, maxCreatedAt.String)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("parse newest created_at: %w", err)
+	}
+
+	return oldest, newest, nil
+}
+
+// ParcelStats сводная статистика по всем посылкам
+type ParcelStats struct {
+	Total    int            `json:"total"`
+	ByStatus map[string]int `json:"by_status"`
+	Clients  int            `json:"clients"`
+}
+
+// Stats собирает сводную статистику по посылкам
+func (s ParcelStore) Stats() (ParcelStats, error) {
+	stats := ParcelStats{ByStatus: map[string]int{}}
+
+	rows, err := s.reader().Query("SELECT status, COUNT(*) FROM parcel GROUP BY status")
+	if err != nil {
+		return stats, checkClosed(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status string
+		var count int
+
+		err := rows.Scan(&status, &count)
+		if err != nil {
+			return stats, err
+		}
+
+		stats.ByStatus[status] = count
+		stats.Total += count
+	}
+
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	err = s.reader().QueryRow("SELECT COUNT(DISTINCT client) FROM parcel").Scan(&stats.Clients)
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// Funnel возвращает воронку посылок: сколько посылок были зарегистрированы,
+// сколько дошли хотя бы до отправки и сколько были доставлены.
+// Этап посылки — самый дальний из текущего статуса и статусов в истории,
+// поэтому исправленная через CorrectStatus доставка всё равно учитывается как доставка.
+// Это приближение: если история удалена (PurgeHistoryOlderThan), этап определяется
+// только по текущему статусу, а каждая посылка считается когда-то зарегистрированной
+func (s ParcelStore) Funnel() (registered, sent, delivered int, err error) {
+	err = s.reader().QueryRow(`SELECT COUNT(*), COALESCE(SUM(stage >= 1), 0), COALESCE(SUM(stage >= 2), 0)
+		FROM (
+			SELECT number, MAX(CASE status WHEN :sent THEN 1 WHEN :delivered THEN 2 ELSE 0 END) AS stage
+			FROM (
+				SELECT number, status FROM parcel
+				UNION ALL
+				SELECT h.number, h.status FROM status_history h JOIN parcel p ON p.number = h.number
+			)
+			GROUP BY number
+		)`,
+		sql.Named("sent", ParcelStatusSent),
+		sql.Named("delivered", ParcelStatusDelivered)).Scan(&registered, &sent, &delivered)
+	if err != nil {
+		return 0, 0, 0, checkClosed(err)
+	}
+
+	return registered, sent, delivered, nil
+}
+
+// Summary сводка по посылкам клиента для отслеживания
+type Summary struct {
+	Total    int            `json:"total"`
+	ByStatus map[string]int `json:"by_status"`
+	// LatestCreatedAt дата создания самой новой посылки, пустая, если посылок нет
+	LatestCreatedAt string `json:"latest_created_at,omitempty"`
+	// InTransit количество посылок в пути (в статусе sent)
+	InTransit int `json:"in_transit"`
+}
+
+// ClientSummary собирает сводку по посылкам клиента client одним запросом
+func (s ParcelStore) ClientSummary(client int) (Summary, error) {
+	summary := Summary{ByStatus: map[string]int{}}
+
+	rows, err := s.reader().Query("SELECT status, COUNT(*), MAX(created_at) FROM parcel WHERE client = :client GROUP BY status",
+		sql.Named("client", client))
+	if err != nil {
+		return summary, checkClosed(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status, latest string
+		var count int
+
+		err := rows.Scan(&status, &count, &latest)
+		if err != nil {
+			return summary, err
+		}
+
+		summary.ByStatus[status] = count
+		summary.Total += count
+		if latest > summary.LatestCreatedAt {
+			summary.LatestCreatedAt = latest
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return summary, err
+	}
+
+	summary.InTransit = summary.ByStatus[ParcelStatusSent]
+
+	return summary, nil
+}
+
+// StorageInfo возвращает количество посылок и размер БД в страницах для планирования места:
+// общий размер в байтах равен pageCount * pageSize.
+// Размер берётся из PRAGMA page_count и page_size, поэтому специфичен для SQLite
+// и относится ко всему файлу БД, а не только к таблице parcel
+func (s ParcelStore) StorageInfo() (rows int64, pageCount int64, pageSize int64, err error) {
+	db := s.reader()
+
+	err = db.QueryRow("SELECT COUNT(*) FROM parcel").Scan(&rows)
+	if err != nil {
+		return 0, 0, 0, checkClosed(err)
+	}
+
+	err = db.QueryRow("PRAGMA page_count").Scan(&pageCount)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	err = db.QueryRow("PRAGMA page_size").Scan(&pageSize)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	return rows, pageCount, pageSize, nil
+}
+
+// StatusStat статистика по посылкам в одном статусе
+type StatusStat struct {
+	Status string `json:"status"`
+	Count  int    `json:"count"`
+	// Oldest и Newest даты создания самой старой и самой новой посылок в статусе
+	Oldest string `json:"oldest"`
+	Newest string `json:"newest"`
+}
+
+// StatusBreakdown возвращает статистику по каждому статусу, в котором есть посылки,
+// одним запросом. Статусы упорядочены по имени
+func (s ParcelStore) StatusBreakdown() ([]StatusStat, error) {
+	rows, err := s.reader().Query("SELECT status, COUNT(*), MIN(created_at), MAX(created_at) FROM parcel GROUP BY status ORDER BY status")
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	var res []StatusStat
+	for rows.Next() {
+		st := StatusStat{}
+
+		err := rows.Scan(&st.Status, &st.Count, &st.Oldest, &st.Newest)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, st)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// MedianDeliveryTime возвращает медиану времени от создания до доставки по доставленным посылкам.
+// Время доставки берётся из истории статусов, а без неё — из delivered_at; посылки, доставленные
+// до появления delivered_at и без записи в истории, не учитываются. Если таких посылок нет, возвращает 0.
+// В SQLite нет функции медианы, поэтому длительности сортируются в Go
+func (s ParcelStore) MedianDeliveryTime() (time.Duration, error) {
+	rows, err := s.reader().Query(`SELECT p.created_at, COALESCE(MAX(h.changed_at), p.delivered_at)
+		FROM parcel p LEFT JOIN status_history h ON h.number = p.number AND h.status = :delivered
+		WHERE p.status = :delivered
+		GROUP BY p.number
+		HAVING COALESCE(MAX(h.changed_at), p.delivered_at) IS NOT NULL`,
+		sql.Named("delivered", ParcelStatusDelivered))
+	if err != nil {
+		return 0, checkClosed(err)
+	}
+	defer rows.Close()
+
+	var durations []time.Duration
+	for rows.Next() {
+		var createdAt, deliveredAt string
+
+		err := rows.Scan(&createdAt, &deliveredAt)
+		if err != nil {
+			return 0, err
+		}
+
+		created, err := time.Parse(time.RFC3339, createdAt)
+		if err != nil {
+			return 0, fmt.Errorf("parse created_at: %w", err)
+		}
+		delivered, err := time.Parse(time.RFC3339, deliveredAt)
+		if err != nil {
+			return 0, fmt.Errorf("parse delivery time: %w", err)
+		}
+
+		durations = append(durations, delivered.Sub(created))
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(durations) == 0 {
+		return 0, nil
+	}
+
+	slices.Sort(durations)
+	mid := len(durations) / 2
+	if len(durations)%2 == 1 {
+		return durations[mid], nil
+	}
+	return (durations[mid-1] + durations[mid]) / 2, nil
+}
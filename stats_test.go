@@ -0,0 +1,495 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestTopAddresses проверяет получение самых частых адресов доставки
+func TestTopAddresses(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	addresses := []string{"b", "a", "c", "a", "b", "a", "d", "c"}
+	for _, address := range addresses {
+		parcel := getTestParcel()
+		parcel.Address = address
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// top addresses
+	top, err := store.TopAddresses(3)
+	require.NoError(t, err)
+	require.Equal(t, []AddressCount{
+		{Address: "a", Count: 3},
+		{Address: "b", Count: 2},
+		{Address: "c", Count: 2},
+	}, top)
+
+	_, err = store.TopAddresses(0)
+	require.Error(t, err)
+}
+
+// TestClientTotals проверяет подсчёт посылок по клиентам
+func TestClientTotals(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	totals, err := store.ClientTotals()
+	require.NoError(t, err)
+	require.NotNil(t, totals)
+	require.Empty(t, totals)
+
+	clients := []int{1, 2, 1, 3, 1, 2}
+	for _, client := range clients {
+		parcel := getTestParcel()
+		parcel.Client = client
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// totals
+	totals, err = store.ClientTotals()
+	require.NoError(t, err)
+	require.Equal(t, map[int]int{1: 3, 2: 2, 3: 1}, totals)
+}
+
+// TestClientDeliveryRates проверяет долю доставленных посылок по клиентам
+func TestClientDeliveryRates(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	seed := map[int][]string{
+		1000: {ParcelStatusDelivered, ParcelStatusDelivered, ParcelStatusSent, ParcelStatusRegistered},
+		2000: {ParcelStatusDelivered},
+		3000: {ParcelStatusSent, ParcelStatusRegistered, ParcelStatusRegistered},
+	}
+	for client, statuses := range seed {
+		for _, status := range statuses {
+			parcel := getTestParcel()
+			parcel.Client = client
+			parcel.Status = status
+
+			_, err := store.Add(parcel)
+			require.NoError(t, err)
+		}
+	}
+
+	// check
+	rates, err := store.ClientDeliveryRates()
+	require.NoError(t, err)
+	require.Len(t, rates, 3)
+	require.InDelta(t, 0.5, rates[1000], 1e-9)
+	require.InDelta(t, 1.0, rates[2000], 1e-9)
+	require.InDelta(t, 0.0, rates[3000], 1e-9)
+}
+
+// TestAgeBuckets проверяет распределение посылок по возрасту
+func TestAgeBuckets(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	day := 24 * time.Hour
+	ages := []time.Duration{time.Hour, 2 * day, 3 * day, 10 * day, 40 * day, 100 * day}
+	for _, age := range ages {
+		parcel := getTestParcel()
+		parcel.CreatedAt = time.Now().Add(-age).UTC().Format(time.RFC3339)
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// buckets
+	counts, err := store.AgeBuckets([]time.Duration{day, 7 * day, 30 * day})
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 1, 2}, counts)
+
+	_, err = store.AgeBuckets([]time.Duration{7 * day, day})
+	require.Error(t, err)
+}
+
+// TestStatusCountsInRange проверяет подсчёт посылок по статусам за период
+func TestStatusCountsInRange(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	seed := []struct {
+		status    string
+		createdAt string
+	}{
+		{ParcelStatusRegistered, "2024-02-29T23:59:59Z"},
+		{ParcelStatusRegistered, "2024-03-01T00:00:00Z"},
+		{ParcelStatusSent, "2024-03-10T12:00:00Z"},
+		{ParcelStatusSent, "2024-03-15T12:00:00Z"},
+		{ParcelStatusDelivered, "2024-03-31T23:59:59Z"},
+		{ParcelStatusDelivered, "2024-04-01T00:00:00Z"},
+	}
+	for _, s := range seed {
+		parcel := getTestParcel()
+		parcel.Status = s.status
+		parcel.CreatedAt = s.createdAt
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// counts
+	from := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	counts, err := store.StatusCountsInRange(from, to)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{
+		ParcelStatusRegistered: 1,
+		ParcelStatusSent:       2,
+		ParcelStatusDelivered:  1,
+	}, counts)
+}
+
+// TestDailyCounts проверяет подсчёт посылок по дням создания
+func TestDailyCounts(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	for _, createdAt := range []string{
+		"2024-03-01T00:00:00Z",
+		"2024-03-01T23:59:59Z",
+		"2024-03-03T12:00:00Z",
+		"2024-03-04T00:00:00Z",
+	} {
+		parcel := getTestParcel()
+		parcel.CreatedAt = createdAt
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// counts
+	from := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+
+	counts, err := store.DailyCounts(from, to)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{
+		"2024-03-01": 2,
+		"2024-03-03": 1,
+	}, counts)
+}
+
+// TestThroughput проверяет подсчёт созданных посылок по последовательным окнам
+func TestThroughput(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	now := time.Now().UTC()
+	for _, ago := range []time.Duration{
+		5 * time.Hour, // раньше первого окна
+		150 * time.Minute,
+		90 * time.Minute,
+		80 * time.Minute,
+		30 * time.Minute,
+		0,
+	} {
+		parcel := getTestParcel()
+		parcel.CreatedAt = now.Add(-ago).Format(time.RFC3339)
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// throughput
+	counts, err := store.Throughput(time.Hour, 3)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 2}, counts)
+
+	counts, err = store.Throughput(time.Hour, 6)
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1, 0, 1, 2, 2}, counts)
+
+	_, err = store.Throughput(time.Millisecond, 3)
+	require.Error(t, err)
+	_, err = store.Throughput(time.Hour, 0)
+	require.Error(t, err)
+}
+
+// TestSharedAddresses проверяет поиск адресов, общих для нескольких клиентов
+func TestSharedAddresses(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	seed := []struct {
+		client  int
+		address string
+	}{
+		{1, "shared"},
+		{2, "shared"},
+		{1, "shared"},
+		{1, "only first"},
+		{1, "only first"},
+		{2, "only second"},
+	}
+	for _, s := range seed {
+		parcel := getTestParcel()
+		parcel.Client = s.client
+		parcel.Address = s.address
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// shared
+	shared, err := store.SharedAddresses()
+	require.NoError(t, err)
+	require.Equal(t, map[string][]int{"shared": {1, 2}}, shared)
+}
+
+// TestTimeBounds проверяет получение дат самой старой и самой новой посылок
+func TestTimeBounds(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	oldest, newest, err := store.TimeBounds()
+	require.NoError(t, err)
+	require.True(t, oldest.IsZero())
+	require.True(t, newest.IsZero())
+
+	dates := []string{"2024-05-10T08:00:00Z", "2023-01-02T03:04:05Z", "2024-12-31T23:59:59Z"}
+	for _, date := range dates {
+		parcel := getTestParcel()
+		parcel.CreatedAt = date
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// bounds
+	oldest, newest, err = store.TimeBounds()
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2023, time.January, 2, 3, 4, 5, 0, time.UTC), oldest)
+	require.Equal(t, time.Date(2024, time.December, 31, 23, 59, 59, 0, time.UTC), newest)
+}
+
+// TestFunnel проверяет подсчёт воронки с учётом истории статусов
+func TestFunnel(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t)).WithHistory()
+
+	registered, sent, delivered, err := store.Funnel()
+	require.NoError(t, err)
+	require.Equal(t, [3]int{0, 0, 0}, [3]int{registered, sent, delivered})
+
+	// одна посылка только зарегистрирована, одна отправлена, две доставлены,
+	// причём у одной из доставленных статус затем исправлен обратно на sent
+	_, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+
+	for i := 0; i < 2; i++ {
+		id, err = store.Add(getTestParcel())
+		require.NoError(t, err)
+		require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+		require.NoError(t, store.SetStatus(id, ParcelStatusDelivered))
+	}
+	require.NoError(t, store.CorrectStatus(id, ParcelStatusSent, "delivered by mistake"))
+
+	// check
+	registered, sent, delivered, err = store.Funnel()
+	require.NoError(t, err)
+	require.Equal(t, 4, registered)
+	require.Equal(t, 3, sent)
+	require.Equal(t, 2, delivered)
+}
+
+// TestClientSummary проверяет сводку по посылкам клиента
+func TestClientSummary(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	seed := []struct {
+		client    int
+		status    string
+		createdAt string
+	}{
+		{1000, ParcelStatusRegistered, "2024-03-01T10:00:00Z"},
+		{1000, ParcelStatusSent, "2024-03-05T10:00:00Z"},
+		{1000, ParcelStatusSent, "2024-03-02T10:00:00Z"},
+		{1000, ParcelStatusDelivered, "2024-02-01T10:00:00Z"},
+		{2000, ParcelStatusSent, "2024-04-01T10:00:00Z"},
+	}
+	for _, s := range seed {
+		parcel := getTestParcel()
+		parcel.Client = s.client
+		parcel.Status = s.status
+		parcel.CreatedAt = s.createdAt
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// check
+	summary, err := store.ClientSummary(1000)
+	require.NoError(t, err)
+	require.Equal(t, Summary{
+		Total: 4,
+		ByStatus: map[string]int{
+			ParcelStatusRegistered: 1,
+			ParcelStatusSent:       2,
+			ParcelStatusDelivered:  1,
+		},
+		LatestCreatedAt: "2024-03-05T10:00:00Z",
+		InTransit:       2,
+	}, summary)
+
+	summary, err = store.ClientSummary(3000)
+	require.NoError(t, err)
+	require.Equal(t, Summary{ByStatus: map[string]int{}}, summary)
+}
+
+// TestStorageInfo проверяет получение количества посылок и размера БД
+func TestStorageInfo(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	_, err := store.SeedParcels(1000, 5, "Unit %d")
+	require.NoError(t, err)
+
+	// check
+	rows, pageCount, pageSize, err := store.StorageInfo()
+	require.NoError(t, err)
+
+	count, err := store.Query().Count()
+	require.NoError(t, err)
+	require.Equal(t, int64(count), rows)
+	require.Positive(t, pageCount)
+	require.Positive(t, pageSize)
+}
+
+// TestStatusBreakdown проверяет статистику по статусам
+func TestStatusBreakdown(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	seed := []struct {
+		status    string
+		createdAt string
+	}{
+		{ParcelStatusRegistered, "2024-03-02T10:00:00Z"},
+		{ParcelStatusRegistered, "2024-03-01T10:00:00Z"},
+		{ParcelStatusRegistered, "2024-03-05T10:00:00Z"},
+		{ParcelStatusSent, "2024-02-01T10:00:00Z"},
+	}
+	for _, s := range seed {
+		parcel := getTestParcel()
+		parcel.Status = s.status
+		parcel.CreatedAt = s.createdAt
+
+		_, err := store.Add(parcel)
+		require.NoError(t, err)
+	}
+
+	// check
+	stats, err := store.StatusBreakdown()
+	require.NoError(t, err)
+	require.Equal(t, []StatusStat{
+		{Status: ParcelStatusRegistered, Count: 3, Oldest: "2024-03-01T10:00:00Z", Newest: "2024-03-05T10:00:00Z"},
+		{Status: ParcelStatusSent, Count: 1, Oldest: "2024-02-01T10:00:00Z", Newest: "2024-02-01T10:00:00Z"},
+	}, stats)
+}
+
+// TestMedianDeliveryTime проверяет медиану времени доставки для нечётного и чётного количества посылок
+func TestMedianDeliveryTime(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	median, err := store.MedianDeliveryTime()
+	require.NoError(t, err)
+	require.Zero(t, median)
+
+	created := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	deliver := func(d time.Duration) {
+		parcel := getTestParcel()
+		parcel.Status = ParcelStatusDelivered
+		parcel.CreatedAt = created.Format(time.RFC3339)
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+
+		_, err = db.Exec("INSERT INTO status_history (number, status, changed_at, reason) VALUES (?, ?, ?, '')",
+			id, ParcelStatusDelivered, created.Add(d).Format(time.RFC3339))
+		require.NoError(t, err)
+	}
+
+	// незавершённая посылка не учитывается
+	_, err = store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// odd
+	deliver(10 * time.Hour)
+	deliver(2 * time.Hour)
+	deliver(100 * time.Hour)
+
+	median, err = store.MedianDeliveryTime()
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Hour, median)
+
+	// even
+	deliver(20 * time.Hour)
+
+	median, err = store.MedianDeliveryTime()
+	require.NoError(t, err)
+	require.Equal(t, 15*time.Hour, median)
+}
+
+// TestMedianDeliveryTimeWithoutHistory проверяет, что без истории статусов
+// время доставки берётся из delivered_at
+func TestMedianDeliveryTimeWithoutHistory(t *testing.T) {
+	// prepare
+	db := openTestDB(t)
+	store := NewParcelStore(db)
+
+	created := time.Now().UTC().Add(-10 * time.Hour)
+	deliver := func() int {
+		parcel := getTestParcel()
+		parcel.CreatedAt = created.Format(time.RFC3339)
+
+		id, err := store.Add(parcel)
+		require.NoError(t, err)
+		require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+		return id
+	}
+
+	// через changeStatus
+	id := deliver()
+	require.NoError(t, store.SetStatus(id, ParcelStatusDelivered))
+
+	// через SetStatusIf
+	id = deliver()
+	ok, err := store.SetStatusIf(id, ParcelStatusSent, ParcelStatusDelivered)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// через AdvanceStatus
+	id = deliver()
+	advanced, _, err := store.AdvanceStatus([]int{id})
+	require.NoError(t, err)
+	require.Equal(t, []int{id}, advanced)
+
+	// check
+	var events int
+	err = db.QueryRow("SELECT COUNT(*) FROM status_history").Scan(&events)
+	require.NoError(t, err)
+	require.Zero(t, events)
+
+	median, err := store.MedianDeliveryTime()
+	require.NoError(t, err)
+	require.InDelta(t, 10*time.Hour, median, float64(time.Minute))
+}
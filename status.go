@@ -0,0 +1,300 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var (
+	// ErrInvalidTransition возвращается при попытке перевести посылку в недопустимый статус
+	ErrInvalidTransition = errors.New("invalid status transition")
+	// ErrReasonRequired возвращается, если для ручного исправления статуса не указана причина
+	ErrReasonRequired = errors.New("reason is required")
+	// ErrConcurrentModification возвращается, если статус посылки изменили в другой транзакции
+	// между его чтением и записью
+	ErrConcurrentModification = errors.New("parcel was modified concurrently")
+)
+
+// nextStatuses допустимые переходы между статусами:
+// ключ — текущий статус, значение — статус, в который из него можно перейти
+var nextStatuses = map[string]string{
+	ParcelStatusRegistered: ParcelStatusSent,
+	ParcelStatusSent:       ParcelStatusDelivered,
+}
+
+// CanTransition сообщает, можно ли перевести посылку из статуса from в статус to.
+// Обращения к БД не требуется, поэтому подходит, например, для блокировки недоступных действий в интерфейсе
+func CanTransition(from, to string) bool {
+	next, ok := nextStatuses[from]
+	return ok && next == to
+}
+
+// AllowedNextStatuses возвращает статусы, в которые можно перевести посылку из статуса from.
+// Для конечного или неизвестного статуса возвращает пустой срез
+func AllowedNextStatuses(from string) []string {
+	next, ok := nextStatuses[from]
+	if !ok {
+		return []string{}
+	}
+	return []string{next}
+}
+
+// statusCodes однобуквенные коды статусов для компактных ответов API
+var statusCodes = map[string]string{
+	ParcelStatusRegistered: "R",
+	ParcelStatusSent:       "S",
+	ParcelStatusDelivered:  "D",
+}
+
+// StatusCode возвращает однобуквенный код статуса посылки: R, S или D.
+// Для неизвестного статуса возвращает пустую строку
+func (p Parcel) StatusCode() string {
+	return statusCodes[p.Status]
+}
+
+// ParseStatusCode возвращает статус по однобуквенному коду, полученному из StatusCode
+func ParseStatusCode(code string) (string, error) {
+	for status, c := range statusCodes {
+		if c == code {
+			return status, nil
+		}
+	}
+	return "", fmt.Errorf("%w code %q", ErrUnknownStatus, code)
+}
+
+// checkTransition проверяет, можно ли перевести посылку из статуса from в статус to
+func checkTransition(from, to string) error {
+	if CanTransition(from, to) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+}
+
+// isBusy сообщает, что транзакция, уже читавшая БД, не смогла начать запись: другая транзакция
+// пишет в БД (SQLITE_BUSY) или записала в неё после чтения (SQLITE_BUSY_SNAPSHOT в режиме WAL).
+// Сама по себе такая ошибка не означает, что изменилась та же посылка
+func isBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code()&0xff == sqlite3.SQLITE_BUSY
+}
+
+// getStatus возвращает текущий статус посылки в рамках транзакции tx
+func getStatus(tx *sql.Tx, number int) (string, error) {
+	var status string
+
+	err := tx.QueryRow("SELECT status FROM parcel WHERE number = :number",
+		sql.Named("number", number)).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrParcelNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return status, nil
+}
+
+// checkMutable возвращает ErrParcelImmutable, если посылка number уже доставлена:
+// у доставленной посылки нельзя менять адрес, получателя и клиента
+func checkMutable(tx *sql.Tx, number int) error {
+	status, err := getStatus(tx, number)
+	if err != nil {
+		return err
+	}
+	if status == ParcelStatusDelivered {
+		return fmt.Errorf("%w: parcel %d", ErrParcelImmutable, number)
+	}
+	return nil
+}
+
+// setDeliveredAt запоминает время перехода в delivered; используется в запросах,
+// меняющих статус, с параметрами :status, :updated_at и :delivered
+const setDeliveredAt = `delivered_at = CASE WHEN :status = :delivered THEN :updated_at ELSE delivered_at END`
+
+// changeStatus меняет статус посылки с прочитанного ранее current на status и добавляет
+// запись в историю статусов. Если статус успели изменить в другой транзакции,
+// возвращает ErrConcurrentModification; при ошибке блокировки транзакция tx откатывается.
+// Исправление с причиной записывается в историю, даже если она не включена через WithHistory
+func (s ParcelStore) changeStatus(tx *sql.Tx, number int, current, status string, reason string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	res, err := tx.Exec(`UPDATE parcel SET status = :status, updated_at = :updated_at, `+setDeliveredAt+`
+		WHERE number = :number AND status = :current`,
+		sql.Named("status", status),
+		sql.Named("updated_at", now),
+		sql.Named("delivered", ParcelStatusDelivered),
+		sql.Named("number", number),
+		sql.Named("current", current))
+	if isBusy(err) {
+		// другая транзакция ждёт, пока эта отпустит блокировку чтения, поэтому сначала
+		// откатываем эту транзакцию, а затем проверяем, изменилась ли сама посылка
+		tx.Rollback()
+
+		var latest string
+		readErr := s.db.QueryRow("SELECT status FROM parcel WHERE number = :number",
+			sql.Named("number", number)).Scan(&latest)
+		if readErr == nil && latest != current {
+			return fmt.Errorf("%w: parcel %d is no longer %s", ErrConcurrentModification, number, current)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: parcel %d is no longer %s", ErrConcurrentModification, number, current)
+	}
+
+	if reason != "" {
+		return addStatusEvent(tx, number, status, now, reason)
+	}
+	err = countStatus(tx, status)
+	if err != nil {
+		return err
+	}
+	return s.recordStatus(tx, number, status, now)
+}
+
+// CorrectStatus исправляет ошибочно выставленный статус посылки, например возвращает
+// доставленную посылку в статус sent. В отличие от SetStatus, правила переходов
+// не проверяются, поэтому причина исправления обязательна и сохраняется в истории статусов
+func (s ParcelStore) CorrectStatus(number int, to string, reason string) error {
+	defer s.observe("CorrectStatus", "", time.Now())
+
+	if !validStatus(to) {
+		return fmt.Errorf("%w: %w %q", ErrInvalidTransition, ErrUnknownStatus, to)
+	}
+	if strings.TrimSpace(reason) == "" {
+		return ErrReasonRequired
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	current, err := getStatus(tx, number)
+	if err != nil {
+		return err
+	}
+
+	err = s.changeStatus(tx, number, current, to, reason)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetStatusIf переводит посылку в статус next, только если её текущий статус равен expected.
+// Возвращает true, если статус был изменён. Переход expected -> next должен быть
+// допустимым, как и в SetStatus
+func (s ParcelStore) SetStatusIf(number int, expected, next string) (bool, error) {
+	defer s.observe("SetStatusIf", "", time.Now())
+
+	err := checkTransition(expected, next)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	res, err := tx.Exec(`UPDATE parcel SET status = :status, updated_at = :updated_at, `+setDeliveredAt+`
+		WHERE number = :number AND status = :expected`,
+		sql.Named("status", next),
+		sql.Named("updated_at", now),
+		sql.Named("delivered", ParcelStatusDelivered),
+		sql.Named("number", number),
+		sql.Named("expected", expected))
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	err = countStatus(tx, next)
+	if err != nil {
+		return false, err
+	}
+
+	err = s.recordStatus(tx, number, next, now)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// AdvanceStatus переводит каждую посылку из numbers на один шаг вперёд:
+// registered -> sent, sent -> delivered. Возвращает номера переведённых посылок
+// и причины, по которым остальные пропущены. Все изменения выполняются в одной транзакции
+func (s ParcelStore) AdvanceStatus(numbers []int) (advanced []int, skipped map[int]string, err error) {
+	defer s.observe("AdvanceStatus", "", time.Now())
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, checkClosed(err)
+	}
+	defer tx.Rollback()
+
+	skipped = map[int]string{}
+	for _, number := range numbers {
+		if _, ok := skipped[number]; ok || slices.Contains(advanced, number) {
+			// повторный номер не продвигаем второй раз
+			continue
+		}
+
+		status, err := getStatus(tx, number)
+		if errors.Is(err, ErrParcelNotFound) {
+			skipped[number] = "parcel not found"
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		next, ok := nextStatuses[status]
+		if !ok {
+			skipped[number] = fmt.Sprintf("no next status after %s", status)
+			continue
+		}
+
+		err = s.changeStatus(tx, number, status, next, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		advanced = append(advanced, number)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return advanced, skipped, nil
+}
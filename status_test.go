@@ -0,0 +1,294 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSetStatusTransitions проверяет, что SetStatus не допускает переходов назад
+func TestSetStatusTransitions(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// set status
+	err = store.SetStatus(id, ParcelStatusDelivered)
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	err = store.SetStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
+
+	err = store.SetStatus(id, ParcelStatusRegistered)
+	require.ErrorIs(t, err, ErrInvalidTransition)
+
+	err = store.SetStatus(-1, ParcelStatusSent)
+	require.ErrorIs(t, err, ErrParcelNotFound)
+}
+
+// TestCorrectStatus проверяет исправление ошибочно выставленного статуса
+func TestCorrectStatus(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db).WithHistory()
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	err = store.SetStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
+	err = store.SetStatus(id, ParcelStatusDelivered)
+	require.NoError(t, err)
+
+	// correct status
+	err = store.CorrectStatus(id, ParcelStatusSent, "")
+	require.ErrorIs(t, err, ErrReasonRequired)
+
+	reason := "marked delivered by mistake"
+	err = store.CorrectStatus(id, ParcelStatusSent, reason)
+	require.NoError(t, err)
+
+	// check
+	parcel, history, err := store.GetWithHistory(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, parcel.Status)
+
+	require.Len(t, history, 4)
+	last := history[len(history)-1]
+	require.Equal(t, ParcelStatusSent, last.Status)
+	require.Equal(t, reason, last.Reason)
+}
+
+// TestSetStatusIf проверяет смену статуса только при совпадении текущего статуса с ожидаемым
+func TestSetStatusIf(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", "tracker.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db).WithHistory()
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	err = store.SetStatus(id, ParcelStatusSent)
+	require.NoError(t, err)
+
+	// stale expected status
+	ok, err := store.SetStatusIf(id, ParcelStatusRegistered, ParcelStatusSent)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, history, err := store.GetWithHistory(id)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	// actual expected status
+	ok, err = store.SetStatusIf(id, ParcelStatusSent, ParcelStatusDelivered)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	stored, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusDelivered, stored.Status)
+}
+
+// TestCanTransition проверяет правила переходов для всех пар статусов
+func TestCanTransition(t *testing.T) {
+	statuses := []string{ParcelStatusRegistered, ParcelStatusSent, ParcelStatusDelivered, "unknown"}
+	allowed := map[[2]string]bool{
+		{ParcelStatusRegistered, ParcelStatusSent}: true,
+		{ParcelStatusSent, ParcelStatusDelivered}:  true,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			require.Equal(t, allowed[[2]string{from, to}], CanTransition(from, to), "%s -> %s", from, to)
+		}
+	}
+}
+
+// TestAllowedNextStatuses проверяет список статусов, доступных из текущего
+func TestAllowedNextStatuses(t *testing.T) {
+	require.Equal(t, []string{ParcelStatusSent}, AllowedNextStatuses(ParcelStatusRegistered))
+	require.Equal(t, []string{ParcelStatusDelivered}, AllowedNextStatuses(ParcelStatusSent))
+	require.Empty(t, AllowedNextStatuses(ParcelStatusDelivered))
+	require.Empty(t, AllowedNextStatuses("unknown"))
+}
+
+// TestStatusCode проверяет преобразование статуса в однобуквенный код и обратно
+func TestStatusCode(t *testing.T) {
+	codes := map[string]string{
+		ParcelStatusRegistered: "R",
+		ParcelStatusSent:       "S",
+		ParcelStatusDelivered:  "D",
+	}
+
+	for status, code := range codes {
+		require.Equal(t, code, Parcel{Status: status}.StatusCode())
+
+		parsed, err := ParseStatusCode(code)
+		require.NoError(t, err)
+		require.Equal(t, status, parsed)
+	}
+
+	require.Empty(t, Parcel{Status: "unknown"}.StatusCode())
+
+	_, err := ParseStatusCode("X")
+	require.ErrorIs(t, err, ErrUnknownStatus)
+	_, err = ParseStatusCode("")
+	require.ErrorIs(t, err, ErrUnknownStatus)
+}
+
+// TestAdvanceStatus проверяет перевод нескольких посылок на следующий шаг
+func TestAdvanceStatus(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	registered, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	sent, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(sent, ParcelStatusSent))
+
+	delivered, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	require.NoError(t, store.SetStatus(delivered, ParcelStatusSent))
+	require.NoError(t, store.SetStatus(delivered, ParcelStatusDelivered))
+
+	// advance
+	advanced, skipped, err := store.AdvanceStatus([]int{registered, sent, delivered, -1, registered})
+	require.NoError(t, err)
+	require.Equal(t, []int{registered, sent}, advanced)
+	require.Equal(t, map[int]string{
+		delivered: "no next status after delivered",
+		-1:        "parcel not found",
+	}, skipped)
+
+	// check
+	p, err := store.Get(registered)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, p.Status)
+
+	p, err = store.Get(sent)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusDelivered, p.Status)
+}
+
+// TestSetStatusConcurrentModification проверяет, что SetStatus обнаруживает изменение статуса
+// другой транзакцией между чтением и записью
+func TestSetStatusConcurrentModification(t *testing.T) {
+	// prepare
+	// в режиме WAL чтение не блокирует запись, поэтому другая транзакция успевает
+	// изменить посылку, пока SetStatus держит открытой свою
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tracker.db")+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+	require.NoError(t, store.EnsureSchema())
+	require.NoError(t, store.Migrate(LatestSchemaVersion()))
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// другой обработчик успевает отправить посылку между чтением и записью
+	racing := store
+	racing.afterStatusRead = func() {
+		require.NoError(t, store.SetStatus(id, ParcelStatusSent))
+	}
+
+	// set status
+	err = racing.SetStatus(id, ParcelStatusSent)
+	require.ErrorIs(t, err, ErrConcurrentModification)
+
+	// check
+	p, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, p.Status)
+}
+
+// TestSetStatusConcurrentModificationRollbackJournal проверяет обнаружение одновременного
+// изменения в режиме журнала по умолчанию, в котором работает основная программа
+func TestSetStatusConcurrentModificationRollbackJournal(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	id, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// пока SetStatus держит блокировку чтения, другой обработчик тоже отправляет посылку.
+	// Какой из них запишет первым, зависит от планировщика, но второй должен получить
+	// ErrConcurrentModification, а не ошибку блокировки
+	other := make(chan error, 1)
+	racing := store
+	racing.afterStatusRead = func() {
+		go func() { other <- store.SetStatus(id, ParcelStatusSent) }()
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// set status
+	errs := []error{racing.SetStatus(id, ParcelStatusSent), <-other}
+
+	// check
+	var succeeded int
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		require.ErrorIs(t, err, ErrConcurrentModification)
+	}
+	require.Equal(t, 1, succeeded)
+
+	p, err := store.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, ParcelStatusSent, p.Status)
+}
+
+// TestSetStatusLockedByOtherParcel проверяет, что ожидание блокировки из-за записи другой
+// посылки не выдаётся за одновременное изменение
+func TestSetStatusLockedByOtherParcel(t *testing.T) {
+	// prepare
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tracker.db")+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(100)")
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewParcelStore(db)
+	require.NoError(t, store.EnsureSchema())
+	require.NoError(t, store.Migrate(LatestSchemaVersion()))
+
+	a, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+	b, err := store.Add(getTestParcel())
+	require.NoError(t, err)
+
+	// другая транзакция держит блокировку на запись, меняя посылку a
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	defer tx.Rollback()
+	_, err = tx.Exec("UPDATE parcel SET address = 'other' WHERE number = ?", a)
+	require.NoError(t, err)
+
+	// set status
+	err = store.SetStatus(b, ParcelStatusSent)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrConcurrentModification)
+
+	// после освобождения блокировки статус меняется
+	require.NoError(t, tx.Rollback())
+	require.NoError(t, store.SetStatus(b, ParcelStatusSent))
+}
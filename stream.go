@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// streamPageSize количество посылок, читаемых из БД за один запрос в StreamAll
+const streamPageSize = 100
+
+// StreamAll отправляет все посылки в канал в порядке возрастания номера.
+// Посылки читаются из БД страницами по streamPageSize, поэтому соединение
+// не удерживается, пока получатель обрабатывает посылки.
+// После завершения канал посылок закрывается, а в канал ошибок отправляется
+// ошибка чтения или ctx.Err() при отмене контекста; затем он тоже закрывается.
+// При успешном завершении канал ошибок закрывается без значений
+func (s ParcelStore) StreamAll(ctx context.Context) (<-chan Parcel, <-chan error) {
+	out := make(chan Parcel)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(errc)
+		defer close(out)
+
+		last := 0
+		for {
+			page, err := s.streamPage(ctx, last, streamPageSize)
+			if err != nil {
+				errc <- err
+				return
+			}
+
+			for _, p := range page {
+				select {
+				case out <- p:
+				case <-ctx.Done():
+					errc <- ctx.Err()
+					return
+				}
+			}
+
+			if len(page) < streamPageSize {
+				return
+			}
+			last = page[len(page)-1].Number
+		}
+	}()
+
+	return out, errc
+}
+
+// StreamBatches передаёт все посылки в fn пачками по batchSize в порядке возрастания номера.
+// Последняя пачка может быть меньше batchSize. Если fn возвращает ошибку,
+// чтение прекращается и эта ошибка возвращается
+func (s ParcelStore) StreamBatches(batchSize int, fn func([]Parcel) error) error {
+	if batchSize <= 0 {
+		return fmt.Errorf("batch size must be positive, got %d", batchSize)
+	}
+
+	last := 0
+	for {
+		batch, err := s.streamPage(context.Background(), last, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err = fn(batch)
+		if err != nil {
+			return err
+		}
+
+		if len(batch) < batchSize {
+			return nil
+		}
+		last = batch[len(batch)-1].Number
+	}
+}
+
+// ResumableExport передаёт в fn посылки с номерами больше after в порядке возрастания номера
+// и после каждых every посылок, а также в конце, вызывает checkpoint с номером последней
+// обработанной посылки. Если экспорт прервался, его можно продолжить, передав в after
+// номер из последнего успешного checkpoint. Ошибка fn или checkpoint прерывает экспорт
+func (s ParcelStore) ResumableExport(after int, every int, fn func(Parcel) error, checkpoint func(last int) error) error {
+	if every <= 0 {
+		return fmt.Errorf("checkpoint interval must be positive, got %d", every)
+	}
+
+	last := after
+	for {
+		page, err := s.streamPage(context.Background(), last, every)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+
+		for _, p := range page {
+			err := fn(p)
+			if err != nil {
+				return err
+			}
+		}
+
+		last = page[len(page)-1].Number
+		err = checkpoint(last)
+		if err != nil {
+			return err
+		}
+
+		if len(page) < every {
+			return nil
+		}
+	}
+}
+
+// streamPage возвращает до limit посылок с номерами больше after
+func (s ParcelStore) streamPage(ctx context.Context, after int, limit int) ([]Parcel, error) {
+	rows, err := s.reader().QueryContext(ctx, "SELECT "+parcelColumns+" FROM parcel WHERE number > :after ORDER BY number LIMIT :limit",
+		sql.Named("after", after),
+		sql.Named("limit", limit))
+	if err != nil {
+		return nil, checkClosed(err)
+	}
+	defer rows.Close()
+
+	return scanParcels(rows)
+}
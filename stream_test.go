@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestStreamAll проверяет получение всех посылок через канал
+func TestStreamAll(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	count := streamPageSize + 5
+	for i := 0; i < count; i++ {
+		_, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+	}
+
+	// stream
+	parcels, errc := store.StreamAll(context.Background())
+
+	var numbers []int
+	for p := range parcels {
+		numbers = append(numbers, p.Number)
+	}
+	require.NoError(t, <-errc)
+
+	// check
+	require.Len(t, numbers, count)
+	require.IsIncreasing(t, numbers)
+}
+
+// TestStreamAllCancel проверяет остановку StreamAll при отмене контекста
+func TestStreamAllCancel(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	for i := 0; i < 5; i++ {
+		_, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// stream
+	parcels, errc := store.StreamAll(ctx)
+
+	_, ok := <-parcels
+	require.True(t, ok)
+	cancel()
+
+	// оставшиеся посылки не читаем, StreamAll должен завершиться сам
+	require.ErrorIs(t, <-errc, context.Canceled)
+
+	_, ok = <-parcels
+	require.False(t, ok)
+}
+
+// TestStreamBatches проверяет разбиение посылок на пачки
+func TestStreamBatches(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	for i := 0; i < 7; i++ {
+		_, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+	}
+
+	// stream
+	var sizes []int
+	err := store.StreamBatches(3, func(batch []Parcel) error {
+		sizes = append(sizes, len(batch))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int{3, 3, 1}, sizes)
+
+	// stop early
+	stop := errors.New("stop")
+	calls := 0
+	err = store.StreamBatches(3, func(batch []Parcel) error {
+		calls++
+		return stop
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, 1, calls)
+}
+
+// TestResumableExport проверяет продолжение прерванного экспорта с последней контрольной точки
+func TestResumableExport(t *testing.T) {
+	// prepare
+	store := NewParcelStore(openTestDB(t))
+
+	var numbers []int
+	for i := 0; i < 10; i++ {
+		id, err := store.Add(getTestParcel())
+		require.NoError(t, err)
+		numbers = append(numbers, id)
+	}
+
+	// exported — сохранённый результат, pending — обработанные, но ещё не сохранённые посылки.
+	// На контрольной точке pending сохраняется вместе с номером, как при записи в файл
+	var exported, pending []int
+	saved := 0
+	fn := func(p Parcel) error {
+		pending = append(pending, p.Number)
+		return nil
+	}
+	checkpoint := func(last int) error {
+		exported = append(exported, pending...)
+		pending = nil
+		saved = last
+		return nil
+	}
+
+	// export with crash
+	crash := errors.New("crash")
+	processed := 0
+	err := store.ResumableExport(0, 3, func(p Parcel) error {
+		processed++
+		if processed == 7 {
+			return crash
+		}
+		return fn(p)
+	}, checkpoint)
+	require.ErrorIs(t, err, crash)
+	require.Equal(t, numbers[5], saved)
+
+	// resume
+	pending = nil
+	err = store.ResumableExport(saved, 3, fn, checkpoint)
+	require.NoError(t, err)
+
+	// check
+	require.Equal(t, numbers, exported)
+	require.Equal(t, numbers[9], saved)
+}
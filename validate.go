@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidParcel возвращается, если данные посылки не прошли проверку
+	ErrInvalidParcel = errors.New("invalid parcel")
+	// ErrUnknownStatus возвращается, если передан статус, которого нет среди ParcelStatus*
+	ErrUnknownStatus = errors.New("unknown status")
+)
+
+// validStatus сообщает, является ли status одним из известных статусов посылки
+func validStatus(status string) bool {
+	switch status {
+	case ParcelStatusRegistered, ParcelStatusSent, ParcelStatusDelivered, ParcelStatusQuarantine:
+		return true
+	}
+	return false
+}
+
+// parcelProblems возвращает описания всех найденных в посылке ошибок
+func parcelProblems(p Parcel) []string {
+	var problems []string
+
+	if p.Client <= 0 {
+		problems = append(problems, fmt.Sprintf("client must be positive, got %d", p.Client))
+	}
+	if !validStatus(p.Status) {
+		problems = append(problems, fmt.Sprintf("unknown status %q", p.Status))
+	}
+	if strings.TrimSpace(p.Address) == "" {
+		problems = append(problems, "empty address")
+	}
+	if _, err := time.Parse(time.RFC3339, p.CreatedAt); err != nil {
+		problems = append(problems, fmt.Sprintf("created_at %q is not RFC3339", p.CreatedAt))
+	}
+
+	return problems
+}
+
+// validateParcel проверяет поля посылки перед сохранением в БД
+func validateParcel(p Parcel) error {
+	problems := parcelProblems(p)
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidParcel, problems[0])
+	}
+	return nil
+}